@@ -0,0 +1,178 @@
+package anserpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chao77977/anserpc/util"
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	_requestIDHeader    = "X-Request-ID"
+	_maxRequestIDLength = 128
+)
+
+type AccessLogFormat int
+
+const (
+	AccessLogJSON AccessLogFormat = iota
+	AccessLogLogfmt
+)
+
+type accessLogOpt struct {
+	w      io.Writer
+	format AccessLogFormat
+}
+
+func (a *accessLogOpt) apply(opts *options) {
+	opts.accessLog = newAccessLogger(a.w, a.format)
+}
+
+// WithAccessLogOpt writes a line to w per call, with request id, remote
+// address, transport, principal, method, duration, error code and size
+// of response.
+func WithAccessLogOpt(w io.Writer, format AccessLogFormat) Option {
+	return &accessLogOpt{
+		w:      w,
+		format: format,
+	}
+}
+
+// accessLogger is nil if access log is disabled
+type accessLogger struct {
+	l log.Logger
+}
+
+func newAccessLogger(w io.Writer, format AccessLogFormat) *accessLogger {
+	f := log.JsonFormat()
+	if format == AccessLogLogfmt {
+		f = log.LogfmtFormat()
+	}
+
+	l := log.New()
+	l.SetHandler(log.StreamHandler(w, f))
+	return &accessLogger{l: l}
+}
+
+// log writes a line of call, size is number of bytes of the written
+// response which includes the call, it is 0 if call is a notification.
+func (a *accessLogger) log(c *call, size int) {
+	if a == nil {
+		return
+	}
+
+	var principal string
+	if p, ok := PrincipalFromContext(c.ctx); ok {
+		principal = p.Name
+	}
+
+	var code int
+	if c.retMsg.hasErr() {
+		code = c.retMsg.Error.Code
+	}
+
+	if c.msg.isNotification() {
+		size = 0
+	}
+
+	id, _ := RequestIDFromContext(c.ctx)
+	a.l.Info("access",
+		"request_id", id,
+		"remote", remoteAddr(c.ctx),
+		"transport", transportFromContext(c.ctx),
+		"principal", principal,
+		"id", string(c.msg.ID),
+		"group", util.FormatName(c.msg.Group),
+		"service", util.FormatName(c.msg.Service),
+		"version", c.version,
+		"method", util.FormatName(c.msg.Method),
+		"duration_ms", float64(c.duration)/float64(time.Millisecond),
+		"code", code,
+		"size", size)
+}
+
+// logRejected writes a line of connection which is rejected before any
+// message is read, e.g. by authentication.
+func (a *accessLogger) logRejected(ctx context.Context, remote string, start time.Time, err error, size int) {
+	if a == nil {
+		return
+	}
+
+	var code int
+	if e, ok := err.(ResultCodeError); ok {
+		code = e.ErrorCode()
+	}
+
+	id, _ := RequestIDFromContext(ctx)
+	a.l.Info("access",
+		"request_id", id,
+		"remote", remote,
+		"transport", transportFromContext(ctx),
+		"principal", "",
+		"id", "",
+		"group", "",
+		"service", "",
+		"version", "",
+		"method", "",
+		"duration_ms", float64(time.Since(start))/float64(time.Millisecond),
+		"code", code,
+		"size", size)
+}
+
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value("anser-request-id").(string)
+	return id, ok
+}
+
+// withRequestID returns ctx with request id, it is generated if id is
+// empty or invalid.
+func withRequestID(ctx context.Context, id string) (context.Context, string) {
+	if !validRequestID(id) {
+		id = randomHex(16)
+	}
+
+	return context.WithValue(ctx, "anser-request-id", id), id
+}
+
+// withHTTPRequestID uses request id of header, and echoes it back
+func withHTTPRequestID(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+	ctx, id := withRequestID(ctx, r.Header.Get(_requestIDHeader))
+	w.Header().Set(_requestIDHeader, id)
+	return ctx
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > _maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// remoteAddr returns remote address of HTTP and Websocket, or local
+// address of IPC.
+func remoteAddr(ctx context.Context) string {
+	if remote, ok := ctx.Value("anser-remote").(string); ok {
+		return remote
+	}
+
+	if remote, ok := ctx.Value("anser-websocket-remote").(net.Addr); ok {
+		return remote.String()
+	}
+
+	if local, ok := ctx.Value("anser-local").(net.Addr); ok {
+		return local.String()
+	}
+
+	return ""
+}
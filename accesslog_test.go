@@ -0,0 +1,174 @@
+package anserpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type requestIDEcho struct{}
+
+func (r *requestIDEcho) ID(ctx context.Context) (string, error) {
+	id, _ := RequestIDFromContext(ctx)
+	return id, nil
+}
+
+func TestAccessLogHTTP(t *testing.T) {
+	var buf bytes.Buffer
+	sr := newTestRegistry(&requestIDEcho{})
+	sr.setAccessLog(newAccessLogger(&buf, AccessLogJSON))
+
+	ts := httptest.NewServer(newHttpServer(withDefaultHTTPOpt(), sr, nil).head)
+	defer ts.Close()
+
+	post := func(id, body string) (*http.Response, string) {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", _defAppJson)
+		if id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var b bytes.Buffer
+		b.ReadFrom(resp.Body)
+		return resp, b.String()
+	}
+
+	// request id of client is echoed, and read by the method
+	resp, body := post("req-1", `{"jsonrpc":"2.0","id":1,"service":"test","method":"id"}`)
+	if got := resp.Header.Get("X-Request-ID"); got != "req-1" {
+		t.Errorf("X-Request-ID = %q, want req-1", got)
+	}
+
+	if !strings.Contains(body, `"result":"req-1"`) {
+		t.Errorf("response = %s, want request id", body)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid access log %q: %v", buf.String(), err)
+	}
+
+	for k, v := range map[string]interface{}{
+		"request_id": "req-1",
+		"transport":  TransportHTTP,
+		"service":    "test",
+		"version":    "1.0",
+		"method":     "id",
+		"id":         "1",
+		"code":       float64(0),
+		"size":       float64(len(body)),
+	} {
+		if entry[k] != v {
+			t.Errorf("access log %s = %v, want %v", k, entry[k], v)
+		}
+	}
+
+	if _, ok := entry["duration_ms"].(float64); !ok || entry["remote"] == "" {
+		t.Errorf("access log %v has no duration or remote", entry)
+	}
+
+	// invalid request id is replaced by a generated one
+	buf.Reset()
+	resp, _ = post("bad id", `{"jsonrpc":"2.0","id":2,"service":"test","method":"unknown"}`)
+	id := resp.Header.Get("X-Request-ID")
+	if id == "" || id == "bad id" {
+		t.Errorf("X-Request-ID = %q, want generated", id)
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil ||
+		entry["request_id"] != id ||
+		entry["code"] != float64(_errMethodNotFound.ErrorCode()) {
+		t.Errorf("access log = %s, want method not found of %s", buf.String(), id)
+	}
+}
+
+func TestAccessLogLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	sr := newTestRegistry(&requestIDEcho{})
+	sr.setAccessLog(newAccessLogger(&buf, AccessLogLogfmt))
+
+	serve(t, sr, `[{"jsonrpc":"2.0","id":1,"service":"test","method":"id"},
+		{"jsonrpc":"2.0","service":"test","method":"id"}]`)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("access log = %q, want 2 lines", buf.String())
+	}
+
+	for _, line := range lines {
+		if !strings.Contains(line, "msg=access") ||
+			!strings.Contains(line, "method=id") ||
+			!strings.Contains(line, "request_id=") {
+			t.Errorf("access log line = %q", line)
+		}
+
+		// nothing is responded to notifications
+		if !strings.Contains(line, "id=1") && !strings.Contains(line, "size=0") {
+			t.Errorf("access log of notification = %q, want size 0", line)
+		}
+	}
+}
+
+func TestAccessLogWrittenSize(t *testing.T) {
+	var buf bytes.Buffer
+	sr := newTestRegistry(&requestIDEcho{})
+	sr.setAccessLog(newAccessLogger(&buf, AccessLogJSON))
+
+	auth := authOpt{NewAPIKeyAuthenticator("", map[string]*Principal{
+		"key-1": {Name: "bob"},
+	})}
+	ts := httptest.NewServer(newHttpServer(withDefaultHTTPOpt(), sr, auth).head)
+	defer ts.Close()
+
+	post := func(key string) (int, map[string]interface{}) {
+		b, _ := msgpack.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1,
+			"service": "test", "method": "id"})
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader(b))
+		req.Header.Set("Content-Type", _defAppMsgpack)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid access log %q: %v", buf.String(), err)
+		}
+
+		buf.Reset()
+		return len(body), entry
+	}
+
+	// size is of the encoded response, not of JSON
+	size, entry := post("key-1")
+	if entry["size"] != float64(size) || entry["principal"] != "bob" {
+		t.Errorf("access log = %v, want size %d of bob", entry, size)
+	}
+
+	// requests rejected by authentication are logged as well
+	size, entry = post("")
+	if entry["size"] != float64(size) || entry["transport"] != TransportHTTP ||
+		entry["code"] != float64(_errUnauthenticated.ErrorCode()) {
+		t.Errorf("access log = %v, want unauthenticated of size %d", entry, size)
+	}
+}
@@ -6,6 +6,10 @@ package anserpc
 */
 
 import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -29,6 +33,11 @@ type Anser struct {
 	rsMu sync.Mutex
 	is   *ipcServer
 	isMu sync.Mutex
+
+	// in-process servers of Handler and ServeConn
+	lh      *httpServer
+	lc      *ipcServer
+	localMu sync.Mutex
 }
 
 func New(ops ...Option) *Anser {
@@ -37,12 +46,19 @@ func New(ops ...Option) *Anser {
 		o.apply(opts)
 	}
 
+	// services are logged once they are registered
+	newSafeLogger(opts.log)
 	a := &Anser{
 		opts: opts,
 		sr:   newServiceRegistry(),
 	}
 
-	newSafeLogger(a.opts.log)
+	a.sr.use(opts.interceptors...)
+	a.sr.setPolicy(opts.policy)
+	a.sr.setTimeout(opts.timeout)
+	a.sr.setRateLimits(opts.rateLimits...)
+	a.sr.setTracer(opts.tracer)
+	a.sr.setAccessLog(opts.accessLog)
 	return a
 }
 
@@ -70,6 +86,50 @@ func (a *Anser) RegisterAPI(apis ...*API) {
 	}
 }
 
+// Unregister removes service of version while the application is
+// running, calls in running are completed by the removed service.
+func (a *Anser) Unregister(group, service, version string) error {
+	return a.sr.unregister(group, service, version)
+}
+
+// Replace replaces service of oldVersion by api at once, the group and
+// service of api are the same as the replaced one, but the version can
+// be different.
+func (a *Anser) Replace(oldVersion string, api *API) error {
+	return a.sr.replace(oldVersion, api)
+}
+
+// OnRegistryChange calls fn on every change of services in order, fn
+// must not register or unregister services.
+func (a *Anser) OnRegistryChange(fn func(RegistryEvent)) {
+	a.sr.observe(fn)
+}
+
+// RegisterHealthChecker registers checker of the application, it is
+// also checked for readiness if it implements ReadyChecker.
+func (a *Anser) RegisterHealthChecker(name string, checker HealthChecker) {
+	a.sr.registerChecker(name, checker)
+}
+
+// SetPolicy replaces the access control policy, e.g. once the policy
+// file is changed.
+func (a *Anser) SetPolicy(policy *Policy) {
+	a.sr.setPolicy(policy)
+}
+
+// ReloadTLSCertificate loads the certificate of WithTLSOpt again, it is
+// also reloaded once the files are changed.
+func (a *Anser) ReloadTLSCertificate() error {
+	a.rsMu.Lock()
+	defer a.rsMu.Unlock()
+
+	if a.rs == nil {
+		return errors.New("HTTP server is not running")
+	}
+
+	return a.rs.reloadCertificate()
+}
+
 func (a *Anser) rpcAllowed() bool {
 	return a.opts.rpc != nil
 }
@@ -115,7 +175,7 @@ func (a *Anser) enableIPCServer() error {
 	a.isMu.Lock()
 	defer a.isMu.Unlock()
 
-	a.is = newIPCServer(a.sr)
+	a.is = newIPCServer(a.sr, a.opts.auth, a.opts.ipcFormat, a.opts.ipcIdle)
 	if err := a.is.setPath(a.opts.ipc); err != nil {
 		return err
 	}
@@ -156,7 +216,7 @@ func (a *Anser) enableRPCServer() error {
 	a.rsMu.Lock()
 	defer a.rsMu.Unlock()
 
-	a.rs = newHttpServer(a.opts.http, a.sr)
+	a.rs = newHttpServer(a.opts.http, a.sr, a.opts.auth)
 	if err := a.rs.setListenAddr(a.opts.rpc); err != nil {
 		return err
 	}
@@ -183,6 +243,8 @@ func (a *Anser) disableRPCServer() {
 }
 
 func (a *Anser) Run() {
+	// calls are accepted again after Shutdown or Close
+	a.sr.calls.reset()
 	a.interruptHandle()
 	if a.rpcAllowed() && a.statusRPCServer() != _statRunning {
 		if err := a.enableRPCServer(); err != nil {
@@ -203,6 +265,31 @@ func (a *Anser) Run() {
 	_xlog.Info("Application is down")
 }
 
+// Handler returns the handler of HTTP and Websocket, it serves the same
+// as the RPC server, but on servers of caller, e.g. httptest.Server.
+func (a *Anser) Handler() http.Handler {
+	a.localMu.Lock()
+	defer a.localMu.Unlock()
+
+	if a.lh == nil {
+		a.lh = newHttpServer(a.opts.http, a.sr, a.opts.auth)
+	}
+
+	return a.lh.head
+}
+
+// ServeConn serves conn as an IPC connection until it is closed, e.g.
+// one end of net.Pipe.
+func (a *Anser) ServeConn(conn net.Conn) {
+	a.localMu.Lock()
+	if a.lc == nil {
+		a.lc = newIPCServer(a.sr, a.opts.auth, a.opts.ipcFormat, a.opts.ipcIdle)
+	}
+	a.localMu.Unlock()
+
+	a.lc.serveIPC(conn)
+}
+
 func (a *Anser) status() {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -232,6 +319,17 @@ func (a *Anser) status() {
 				strings.ToUpper(strings.Join(methods, "/")))
 		}
 
+		if a.opts.http.metricsPath != "" {
+			_xlog.Info("HTTP: metrics path is " + a.opts.http.metricsPath)
+		}
+
+		if a.opts.http.tls != nil {
+			_xlog.Info("HTTP: TLS enabled")
+			if a.opts.http.tls.clientCAFile != "" {
+				_xlog.Info("HTTP: client certificate required")
+			}
+		}
+
 		if a.opts.http.WebsocketAllowed {
 			_xlog.Info("Websocket: enabled")
 		} else {
@@ -240,7 +338,7 @@ func (a *Anser) status() {
 	}
 
 	if a.statusIPCServer() == _statRunning {
-		_xlog.Info("IPC: path is " + string(a.is.endpoint))
+		_xlog.Info("IPC: path is " + a.is.path())
 	}
 
 	if a.opts.intrpt == nil || !a.opts.intrpt.disableInterruptHandler {
@@ -250,8 +348,75 @@ func (a *Anser) status() {
 	_xlog.Info("Application started")
 }
 
-func (a *Anser) Close() {
+// Shutdown stops accepting connections, and waits for calls in handling
+// on all transports until ctx is done. Then Websocket clients are sent
+// close frames, the remaining calls are cancelled, and the number of
+// them is returned with the error of ctx.
+func (a *Anser) Shutdown(ctx context.Context) (int, error) {
+	idle := a.sr.calls.drain()
+
+	a.isMu.Lock()
+	if a.is != nil {
+		a.is.closeListener()
+	}
+	a.isMu.Unlock()
+
+	// the server is shut down without the lock, which may take until
+	// ctx is done
+	a.rsMu.Lock()
+	rs := a.rs
+	a.rsMu.Unlock()
+
+	if rs != nil {
+		rs.shutdown(ctx)
+	}
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+	}
+
+	if rs != nil {
+		rs.goingAway(_goingAwayReason)
+	}
+
+	a.localMu.Lock()
+	if a.lh != nil {
+		a.lh.goingAway(_goingAwayReason)
+	}
+	a.localMu.Unlock()
+
+	abandoned := a.sr.calls.abort()
 	a.disableRPCServer()
 	a.disableIPCServer()
+	a.closeLocalConns()
 	a.wg.Wait()
+
+	if abandoned != 0 {
+		_xlog.Info(Fmt("Application: %d call(s) abandoned", abandoned))
+		return abandoned, ctx.Err()
+	}
+
+	return 0, nil
+}
+
+func (a *Anser) closeLocalConns() {
+	a.localMu.Lock()
+	defer a.localMu.Unlock()
+
+	if a.lh != nil {
+		a.lh.codecs.close()
+	}
+
+	if a.lc != nil {
+		a.lc.codecs.close()
+	}
+}
+
+// Close shuts down servers without waiting for calls in handling, the
+// application can be run again by Run.
+func (a *Anser) Close() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.Shutdown(ctx)
 }
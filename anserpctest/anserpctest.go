@@ -0,0 +1,294 @@
+/*
+Package anserpctest provides servers of anserpc for tests. Services are
+served in process, on an httptest server for HTTP and Websocket, and on
+a unix socket in a temp dir. Servers and clients are closed once the
+test is done.
+
+	func TestAdd(t *testing.T) {
+		s := anserpctest.NewServer(t, []*anserpc.API{
+			{Service: "calc", Version: "1.0", Public: true, Receiver: &calc{}},
+		})
+
+		s.Each(t, func(t *testing.T, c *client.Client) {
+			var sum int
+			err := c.Call(context.Background(), "", "calc", "", "Add", &sum, 1, 2)
+			...
+		})
+	}
+*/
+package anserpctest
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chao77977/anserpc"
+	"github.com/chao77977/anserpc/client"
+)
+
+// Codes of errors responded by anserpc
+const (
+	CodeDefault                  = anserpc.CodeDefault
+	CodeInvalidRequest           = anserpc.CodeInvalidRequest
+	CodeMethodNotFound           = anserpc.CodeMethodNotFound
+	CodeInvalidParams            = anserpc.CodeInvalidParams
+	CodeInternal                 = anserpc.CodeInternal
+	CodeParse                    = anserpc.CodeParse
+	CodeProtoVersion             = anserpc.CodeProtoVersion
+	CodeServiceOrMethodNotFound  = anserpc.CodeServiceOrMethodNotFound
+	CodeServiceNotFound          = anserpc.CodeServiceNotFound
+	CodeResultErrorNotFound      = anserpc.CodeResultErrorNotFound
+	CodeTooManyResults           = anserpc.CodeTooManyResults
+	CodeMethodCrashed            = anserpc.CodeMethodCrashed
+	CodeTooManyParams            = anserpc.CodeTooManyParams
+	CodeMissingValueParams       = anserpc.CodeMissingValueParams
+	CodeHandleTimeout            = anserpc.CodeHandleTimeout
+	CodeNotificationsUnsupported = anserpc.CodeNotificationsUnsupported
+	CodeSubscriptionNotFound     = anserpc.CodeSubscriptionNotFound
+	CodeUnauthenticated          = anserpc.CodeUnauthenticated
+	CodePermissionDenied         = anserpc.CodePermissionDenied
+	CodeVersionNotFound          = anserpc.CodeVersionNotFound
+	CodeRequestCanceled          = anserpc.CodeRequestCanceled
+	CodeRateLimited              = anserpc.CodeRateLimited
+	CodeShuttingDown             = anserpc.CodeShuttingDown
+)
+
+const (
+	TransportInProcess = "in-process"
+	TransportHTTP      = anserpc.TransportHTTP
+	TransportWebsocket = anserpc.TransportWebsocket
+	TransportIPC       = anserpc.TransportIPC
+)
+
+var _transports = []string{TransportInProcess, TransportHTTP,
+	TransportWebsocket, TransportIPC}
+
+type nopLogger struct{}
+
+func (nopLogger) Crit(msg string, ctx ...interface{})  {}
+func (nopLogger) Warn(msg string, ctx ...interface{})  {}
+func (nopLogger) Error(msg string, ctx ...interface{}) {}
+func (nopLogger) Info(msg string, ctx ...interface{})  {}
+func (nopLogger) Debug(msg string, ctx ...interface{}) {}
+
+// Server serves services of APIs, the HTTP server and the unix socket
+// are started once they are used.
+type Server struct {
+	App *anserpc.Anser
+
+	t        testing.TB
+	mu       sync.Mutex
+	http     *httptest.Server
+	listener net.Listener
+	path     string
+	closed   bool
+}
+
+// NewServer returns a server of apis, logs are discarded unless a logger
+// is set by opts. Endpoints of opts are ignored, the server is never run.
+func NewServer(t testing.TB, apis []*anserpc.API, opts ...anserpc.Option) *Server {
+	t.Helper()
+
+	opts = append([]anserpc.Option{anserpc.WithLoggerOpt(nopLogger{})}, opts...)
+	s := &Server{
+		App: anserpc.New(opts...),
+		t:   t,
+	}
+
+	s.App.RegisterAPI(apis...)
+	t.Cleanup(s.close)
+	return s
+}
+
+// URL returns http:// of the HTTP server, Websocket is served on ws://
+// of the same address.
+func (s *Server) URL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.http == nil {
+		s.http = httptest.NewServer(s.App.Handler())
+	}
+
+	return s.http.URL
+}
+
+// WebsocketURL returns ws:// of the HTTP server
+func (s *Server) WebsocketURL() string {
+	return "ws" + strings.TrimPrefix(s.URL(), "http")
+}
+
+// IPCPath returns path of the unix socket
+func (s *Server) IPCPath() string {
+	s.t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		return s.path
+	}
+
+	dir, err := ioutil.TempDir("", "anserpctest")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "anser.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		s.t.Fatal(err)
+	}
+
+	s.listener, s.path = listener, path
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.App.ServeConn(conn)
+		}
+	}()
+
+	return path
+}
+
+// Client returns a client of the in-process transport
+func (s *Server) Client() *client.Client {
+	c, conn := net.Pipe()
+	go s.App.ServeConn(conn)
+
+	return s.track(client.NewClient(c))
+}
+
+// HTTPClient returns a client of the HTTP server
+func (s *Server) HTTPClient(opts ...client.DialOption) *client.Client {
+	return s.dial(s.URL(), opts...)
+}
+
+// WebsocketClient returns a client connected to the Websocket server
+func (s *Server) WebsocketClient(opts ...client.DialOption) *client.Client {
+	return s.dial(s.WebsocketURL(), opts...)
+}
+
+// IPCClient returns a client connected to the unix socket
+func (s *Server) IPCClient() *client.Client {
+	return s.dial(s.IPCPath())
+}
+
+// ClientOf returns a client of transport, which is one of the Transport
+// constants.
+func (s *Server) ClientOf(transport string, opts ...client.DialOption) *client.Client {
+	s.t.Helper()
+
+	switch transport {
+	case TransportInProcess:
+		return s.Client()
+	case TransportHTTP:
+		return s.HTTPClient(opts...)
+	case TransportWebsocket:
+		return s.WebsocketClient(opts...)
+	case TransportIPC:
+		return s.IPCClient()
+	}
+
+	s.t.Fatalf("unknown transport %q", transport)
+	return nil
+}
+
+// Each runs fn as a subtest on every transport, named by the transport
+func (s *Server) Each(t *testing.T, fn func(t *testing.T, c *client.Client)) {
+	t.Helper()
+
+	for _, transport := range _transports {
+		c := s.ClientOf(transport)
+		t.Run(transport, func(t *testing.T) {
+			fn(t, c)
+		})
+	}
+}
+
+func (s *Server) dial(url string, opts ...client.DialOption) *client.Client {
+	s.t.Helper()
+
+	c, err := client.Dial(url, opts...)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return s.track(c)
+}
+
+// track closes c once the test is done
+func (s *Server) track(c *client.Client) *client.Client {
+	s.t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func (s *Server) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+		os.RemoveAll(filepath.Dir(s.path))
+	}
+
+	s.App.Close()
+	if s.http != nil {
+		s.http.Close()
+	}
+}
+
+// ErrorCode returns code of err, false if it is not an error responded
+// by server.
+func ErrorCode(err error) (int, bool) {
+	if e, ok := err.(anserpc.ResultCodeError); ok {
+		return e.ErrorCode(), true
+	}
+
+	return 0, false
+}
+
+// AssertErrorCode fails the test if err is not an error of code
+func AssertErrorCode(t testing.TB, err error, code int) {
+	t.Helper()
+
+	got, ok := ErrorCode(err)
+	if !ok {
+		t.Errorf("error = %v, want error code %d", err, code)
+		return
+	}
+
+	if got != code {
+		t.Errorf("error code = %d (%v), want %d", got, err, code)
+	}
+}
+
+// AssertNoError fails the test if err is not nil
+func AssertNoError(t testing.TB, err error) {
+	t.Helper()
+
+	if err != nil {
+		if code, ok := ErrorCode(err); ok {
+			t.Errorf("error = %v (code %d), want nil", err, code)
+			return
+		}
+
+		t.Errorf("error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,100 @@
+package anserpctest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/chao77977/anserpc"
+	"github.com/chao77977/anserpc/anserpctest"
+	"github.com/chao77977/anserpc/client"
+)
+
+type calc struct{}
+
+func (c *calc) Add(a, b int) (int, error) { return a + b, nil }
+
+func (c *calc) Who(ctx context.Context) (string, error) {
+	p, _ := anserpc.PrincipalFromContext(ctx)
+	return p.Name, nil
+}
+
+func newCalcServer(t *testing.T, opts ...anserpc.Option) *anserpctest.Server {
+	return anserpctest.NewServer(t, []*anserpc.API{{
+		Group:    "math",
+		Service:  "calc",
+		Version:  "1.0",
+		Public:   true,
+		Receiver: &calc{},
+	}}, opts...)
+}
+
+func TestEachTransport(t *testing.T) {
+	s := newCalcServer(t)
+
+	var transports []string
+	s.Each(t, func(t *testing.T, c *client.Client) {
+		transports = append(transports, t.Name())
+
+		var sum int
+		err := c.Call(context.Background(), "math", "calc", "1.0", "Add", &sum, 1, 2)
+		anserpctest.AssertNoError(t, err)
+		if sum != 3 {
+			t.Errorf("sum = %d, want 3", sum)
+		}
+
+		err = c.Call(context.Background(), "math", "calc", "2.0", "Add", &sum, 1, 2)
+		anserpctest.AssertErrorCode(t, err, anserpctest.CodeVersionNotFound)
+
+		err = c.Call(context.Background(), "math", "calc", "", "Add", &sum, 1, 2, 3)
+		anserpctest.AssertErrorCode(t, err, anserpctest.CodeTooManyParams)
+	})
+
+	if len(transports) != 4 {
+		t.Errorf("transports = %v, want 4", transports)
+	}
+}
+
+func TestAuthOptions(t *testing.T) {
+	s := newCalcServer(t, anserpc.WithAuthOpt(
+		anserpc.NewAPIKeyAuthenticator("X-API-Key", map[string]*anserpc.Principal{
+			"secret": {Name: "ops"},
+		}),
+	))
+
+	var who string
+	err := s.HTTPClient().Call(context.Background(), "math", "calc", "", "Who", &who)
+	anserpctest.AssertErrorCode(t, err, anserpctest.CodeUnauthenticated)
+
+	c := s.WebsocketClient(client.WithAPIKey("secret"))
+	err = c.Call(context.Background(), "math", "calc", "", "Who", &who)
+	if anserpctest.AssertNoError(t, err); who != "ops" {
+		t.Errorf("principal = %q, want ops", who)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	if _, ok := anserpctest.ErrorCode(errors.New("closed")); ok {
+		t.Error("code of non-RPC error, want none")
+	}
+
+	if code, ok := anserpctest.ErrorCode(&client.Error{Code: -1}); !ok || code != -1 {
+		t.Errorf("code = %d, %v, want -1", code, ok)
+	}
+}
+
+func TestURL(t *testing.T) {
+	s := newCalcServer(t)
+
+	// the HTTP server is started once it is used
+	resp, err := http.Get(s.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
@@ -1,30 +1,63 @@
 package anserpc
 
 import (
+	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/rcrowley/go-metrics"
 )
 
+const (
+	_builtInService = "built-in"
+)
+
 type API struct {
 	Group    string
 	Service  string
 	Version  string
 	Receiver interface{}
 	Public   bool
+
+	// ParamNames maps object params onto positional args of method,
+	// e.g. {"Add": {"a", "b"}} accepts params {"a": 1, "b": 2}. Names must
+	// be unique and match the number of args.
+	ParamNames map[string][]string
+
+	// Interceptors run around methods of service, after global and
+	// group ones
+	Interceptors []Interceptor
+
+	// Timeout of methods, it overrides the global one(WithTimeoutOpt),
+	// and MethodTimeouts overrides it, e.g. {"Restart": time.Minute}
+	Timeout        time.Duration
+	MethodTimeouts map[string]time.Duration
+
+	// MaxConcurrency limits in-flight methods of service, requests over
+	// it are rejected with error "rate limited". It is unlimited if 0.
+	MaxConcurrency int
+
+	// methods renamed on registration, e.g. "rpc.discover" of built-in
+	// service, which is not a valid name of Go method
+	renames map[string]string
 }
 
-// built-in APIs
-var _builtInAPIs = []*API{
-	&API{
-		Service:  "built-in",
-		Version:  "1.0",
-		Receiver: &builtInService{},
-		Public:   true,
-	},
+// built-in APIs, which are registered with registry
+func builtInAPIs(sr *serviceRegistry) []*API {
+	return []*API{
+		&API{
+			Service:  _builtInService,
+			Version:  "1.0",
+			Receiver: &builtInService{sr: sr},
+			Public:   true,
+			renames:  map[string]string{"Discover": _discoverMethod},
+		},
+	}
 }
 
-type builtInService struct{}
+type builtInService struct {
+	sr *serviceRegistry
+}
 
 func (s builtInService) Hello() (string, error) { return "olleh", nil }
 
@@ -37,3 +70,14 @@ func (s builtInService) Metrics() (string, error) {
 
 	return string(data), nil
 }
+
+// Health returns results of health checkers and readiness
+func (s builtInService) Health(ctx context.Context) (*HealthReport, error) {
+	return s.sr.checkHealth(ctx), nil
+}
+
+// Discover returns OpenRPC document of methods available to caller, it
+// is registered as "rpc.discover".
+func (s builtInService) Discover(ctx context.Context) (*OpenRPC, error) {
+	return s.sr.discover(ctx), nil
+}
@@ -0,0 +1,175 @@
+package anserpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNoCredentials is returned by authenticator if the request does
+	// not carry its credentials, the next authenticator is tried.
+	ErrNoCredentials = errors.New("no credentials")
+)
+
+// Principal is the authenticated caller, methods read it from ctx by
+// PrincipalFromContext.
+type Principal struct {
+	Name  string
+	Roles []string
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value("anser-principal").(*Principal)
+	return p, ok
+}
+
+// AuthInfo is what authenticators evaluate, Header is from HTTP request
+// or Websocket upgrade request, TLS is set if it is served over TLS, and
+// Conn is only set on IPC. PeerCred is set on IPC if the platform
+// supports it, e.g. Linux.
+type AuthInfo struct {
+	Transport  string
+	RemoteAddr string
+	Header     http.Header
+	TLS        *tls.ConnectionState
+	Conn       net.Conn
+	PeerCred   *PeerCred
+}
+
+// PeerCred is the credentials of the process on the other side of unix
+// socket, they are read by SO_PEERCRED once it is connected.
+type PeerCred struct {
+	Pid int32
+	Uid uint32
+	Gid uint32
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, info *AuthInfo) (*Principal, error)
+}
+
+type AuthenticatorFunc func(ctx context.Context, info *AuthInfo) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, info *AuthInfo) (*Principal, error) {
+	return f(ctx, info)
+}
+
+// NewBearerTokenAuthenticator verifies token of header
+// "Authorization: Bearer <token>".
+func NewBearerTokenAuthenticator(verify func(ctx context.Context, token string) (*Principal, error)) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, info *AuthInfo) (*Principal, error) {
+		auth := info.Header.Get("Authorization")
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+			return nil, ErrNoCredentials
+		}
+
+		return verify(ctx, strings.TrimSpace(auth[7:]))
+	})
+}
+
+// NewAPIKeyAuthenticator looks up the key of header in keys, header is
+// "X-API-Key" if it is empty.
+func NewAPIKeyAuthenticator(header string, keys map[string]*Principal) Authenticator {
+	if header == "" {
+		header = "X-API-Key"
+	}
+
+	return AuthenticatorFunc(func(ctx context.Context, info *AuthInfo) (*Principal, error) {
+		key := info.Header.Get(header)
+		if key == "" {
+			return nil, ErrNoCredentials
+		}
+
+		for k, p := range keys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				return p, nil
+			}
+		}
+
+		return nil, _errUnauthenticated
+	})
+}
+
+// NewIPCAuthenticator authenticates every IPC connection as p, the unix
+// socket is only accessible to the owner of server.
+func NewIPCAuthenticator(p *Principal) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, info *AuthInfo) (*Principal, error) {
+		if info.Transport != TransportIPC {
+			return nil, ErrNoCredentials
+		}
+
+		return p, nil
+	})
+}
+
+// NewPeerCredAuthenticator authenticates IPC connections by the user id
+// of the peer process, connections of other users are unauthenticated.
+func NewPeerCredAuthenticator(uids map[uint32]*Principal) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, info *AuthInfo) (*Principal, error) {
+		if info.Transport != TransportIPC || info.PeerCred == nil {
+			return nil, ErrNoCredentials
+		}
+
+		p, ok := uids[info.PeerCred.Uid]
+		if !ok {
+			return nil, _errUnauthenticated
+		}
+
+		return p, nil
+	})
+}
+
+type authOpt []Authenticator
+
+func (a authOpt) apply(opts *options) {
+	opts.auth = append(opts.auth, a...)
+}
+
+// WithAuthOpt enables authentication, authenticators are tried in order
+// until one of them returns a principal or an error other than
+// ErrNoCredentials.
+func WithAuthOpt(authenticators ...Authenticator) Option {
+	return authOpt(authenticators)
+}
+
+// authenticate returns ctx with principal, it does nothing if no
+// authenticator is configured.
+func (a authOpt) authenticate(ctx context.Context, info *AuthInfo) (context.Context, error) {
+	if len(a) == 0 {
+		return ctx, nil
+	}
+
+	for _, authenticator := range a {
+		p, err := authenticator.Authenticate(ctx, info)
+		if err == ErrNoCredentials {
+			continue
+		}
+
+		if err != nil || p == nil {
+			_xlog.Debug("Authentication failure", "transport", info.Transport,
+				"remote", info.RemoteAddr, "err", err)
+			return ctx, _errUnauthenticated
+		}
+
+		return context.WithValue(ctx, "anser-principal", p), nil
+	}
+
+	_xlog.Debug("Authentication failure", "transport", info.Transport,
+		"remote", info.RemoteAddr, "err", ErrNoCredentials)
+	return ctx, _errUnauthenticated
+}
@@ -0,0 +1,209 @@
+package anserpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type whoami struct{}
+
+func (w *whoami) Name(ctx context.Context) (string, error) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+
+	return p.Name, nil
+}
+
+func newAuthTestServer() *httptest.Server {
+	auth := authOpt{
+		NewBearerTokenAuthenticator(func(ctx context.Context, token string) (*Principal, error) {
+			if token != "secret" {
+				return nil, _errUnauthenticated
+			}
+
+			return &Principal{Name: "alice", Roles: []string{"admin"}}, nil
+		}),
+		NewAPIKeyAuthenticator("", map[string]*Principal{
+			"key-1": {Name: "bob"},
+		}),
+	}
+
+	return httptest.NewServer(newHttpServer(withDefaultHTTPOpt(),
+		newTestRegistry(&whoami{}), auth).head)
+}
+
+func postWithHeader(t *testing.T, url, key, value string) (int, *jsonMessage) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(
+		`{"jsonrpc":"2.0","id":1,"service":"test","method":"name"}`))
+	req.Header.Set("content-type", _defAppJson)
+	if key != "" {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var msg jsonMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+
+	return resp.StatusCode, &msg
+}
+
+func TestAuthenticateHTTP(t *testing.T) {
+	ts := newAuthTestServer()
+	defer ts.Close()
+
+	for _, c := range []struct {
+		key, value string
+		name       string
+	}{
+		{"Authorization", "Bearer secret", `"alice"`},
+		{"Authorization", "bearer secret", `"alice"`},
+		{"X-API-Key", "key-1", `"bob"`},
+	} {
+		code, msg := postWithHeader(t, ts.URL, c.key, c.value)
+		if code != http.StatusOK || string(msg.Result) != c.name {
+			t.Errorf("%s: %s = %d %+v, want %s", c.key, c.value, code,
+				msg, c.name)
+		}
+	}
+
+	for _, c := range []struct {
+		key, value string
+	}{
+		{"", ""},
+		{"Authorization", "Bearer wrong"},
+		{"Authorization", "Basic c2VjcmV0"},
+		{"X-API-Key", "key-2"},
+	} {
+		code, msg := postWithHeader(t, ts.URL, c.key, c.value)
+		if code != http.StatusUnauthorized || !msg.hasErr() ||
+			msg.Error.Code != _errUnauthenticated.ErrorCode() {
+			t.Errorf("%s: %s = %d %+v, want unauthenticated", c.key,
+				c.value, code, msg)
+		}
+	}
+}
+
+func TestAuthenticateIPC(t *testing.T) {
+	auth := authOpt{NewIPCAuthenticator(&Principal{Name: "local"})}
+
+	ctx, err := auth.authenticate(context.Background(),
+		&AuthInfo{Transport: TransportIPC})
+	if p, ok := PrincipalFromContext(ctx); err != nil || !ok || p.Name != "local" {
+		t.Errorf("IPC principal = %v %v, want local", p, err)
+	}
+
+	if _, err := auth.authenticate(context.Background(), &AuthInfo{
+		Transport: TransportHTTP,
+		Header:    make(http.Header),
+	}); err != _errUnauthenticated {
+		t.Errorf("HTTP error = %v, want unauthenticated", err)
+	}
+
+	// authentication is disabled without authenticators
+	ctx, err = authOpt(nil).authenticate(context.Background(),
+		&AuthInfo{Transport: TransportHTTP})
+	if _, ok := PrincipalFromContext(ctx); err != nil || ok {
+		t.Errorf("disabled authentication = %v, want no principal", err)
+	}
+}
+
+func TestAuthenticateWebsocketFormat(t *testing.T) {
+	ts := newAuthTestServer()
+	defer ts.Close()
+
+	// the error is responded in format of the subprotocol
+	dialer := websocket.Dialer{Subprotocols: []string{"msgpack"}}
+	_, resp, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err == nil || resp == nil {
+		t.Fatalf("dial = %v, want unauthorized", err)
+	}
+	defer resp.Body.Close()
+
+	var out wireResponse
+	if err := msgpack.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized ||
+		resp.Header.Get("content-type") != _defAppMsgpack ||
+		fmt.Sprint(out.Error["code"]) != fmt.Sprint(_errUnauthenticated.ErrorCode()) {
+		t.Errorf("response = %d %v %+v, want unauthenticated in msgpack",
+			resp.StatusCode, resp.Header, out)
+	}
+}
+
+func TestAuthenticatePeerCred(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_PEERCRED is only supported on Linux")
+	}
+
+	dir, err := ioutil.TempDir("", "anserpc-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", filepath.Join(dir, "anser.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	client, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cred := peerCredOf(conn)
+	if cred == nil || cred.Uid != uint32(os.Getuid()) || cred.Pid != int32(os.Getpid()) {
+		t.Fatalf("peer credentials = %+v, want of this process", cred)
+	}
+
+	auth := authOpt{NewPeerCredAuthenticator(map[uint32]*Principal{
+		cred.Uid: {Name: "local"},
+	})}
+
+	ctx, err := auth.authenticate(context.Background(),
+		&AuthInfo{Transport: TransportIPC, PeerCred: cred})
+	if p, ok := PrincipalFromContext(ctx); err != nil || !ok || p.Name != "local" {
+		t.Errorf("principal = %v %v, want local", p, err)
+	}
+
+	if _, err := auth.authenticate(context.Background(), &AuthInfo{
+		Transport: TransportIPC,
+		PeerCred:  &PeerCred{Uid: cred.Uid + 1},
+	}); err != _errUnauthenticated {
+		t.Errorf("error of other user = %v, want unauthenticated", err)
+	}
+}
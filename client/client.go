@@ -0,0 +1,277 @@
+/*
+Package client implements a client of anserpc servers. It can call
+services over HTTP, Websocket and IPC(unix socket).
+*/
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	_defJsonRpcVersion = "2.0"
+
+	_subscribeMethod    = "subscribe"
+	_unsubscribeMethod  = "unsubscribe"
+	_notificationMethod = "subscription"
+)
+
+var (
+	ErrClientClosed  = errors.New("client is closed")
+	ErrNoResult      = errors.New("no result in response")
+	ErrMissingResult = errors.New("response of request not found")
+
+	ErrNotificationsUnsupported  = errors.New("notifications not supported")
+	ErrSubscriptionQueueOverflow = errors.New("subscription queue overflow")
+)
+
+// NamedParams is sent as object params if it is the only arg, e.g.
+// c.Call(ctx, "", "calc", "", "Add", &sum, NamedParams{"a": 1, "b": 2})
+type NamedParams map[string]interface{}
+
+type transport interface {
+	send(ctx context.Context, msgs []*jsonMessage, isBatch bool) ([]*jsonMessage, error)
+	close() error
+}
+
+type Client struct {
+	tp     transport
+	nextID uint64
+	closed int32
+}
+
+// Dial connects to an anserpc server. The following urls are supported,
+// http://host:port, https://host:port, ws://host:port, wss://host:port
+// and the path of unix socket, e.g. /var/run/anser.sock
+func Dial(rawurl string, opts ...DialOption) (*Client, error) {
+	return DialContext(context.Background(), rawurl, opts...)
+}
+
+func DialContext(ctx context.Context, rawurl string, opts ...DialOption) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &dialConfig{header: make(http.Header)}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var tp transport
+	switch u.Scheme {
+	case "http", "https":
+		tp, err = newHTTPTransport(rawurl, cfg)
+	case "ws", "wss":
+		tp, err = newWebsocketTransport(ctx, rawurl, cfg)
+	case "unix":
+		tp, err = newIPCTransport(ctx, u.Path)
+	case "":
+		tp, err = newIPCTransport(ctx, rawurl)
+	default:
+		return nil, fmt.Errorf("no known transport for url scheme %q", u.Scheme)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{tp: tp}, nil
+}
+
+// NewClient returns a client on conn, which is served as an IPC
+// connection, e.g. one end of net.Pipe served by Anser.ServeConn.
+func NewClient(conn net.Conn) *Client {
+	return &Client{tp: newIPCConnTransport(conn)}
+}
+
+func (c *Client) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return nil
+	}
+
+	return c.tp.close()
+}
+
+func (c *Client) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func (c *Client) newMessage(group, service, version, method string, args ...interface{}) (*jsonMessage, error) {
+	msg := &jsonMessage{
+		Version:        _defJsonRpcVersion,
+		Group:          group,
+		Service:        service,
+		ServiceVersion: version,
+		Method:         method,
+		ID:             c.newID(),
+	}
+
+	if len(args) == 1 {
+		if named, ok := args[0].(NamedParams); ok {
+			params, err := json.Marshal(named)
+			if err != nil {
+				return nil, err
+			}
+
+			msg.Params = params
+			return msg, nil
+		}
+	}
+
+	if len(args) != 0 {
+		params, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.Params = params
+	}
+
+	return msg, nil
+}
+
+func (c *Client) newID() json.RawMessage {
+	id := atomic.AddUint64(&c.nextID, 1)
+	return json.RawMessage(strconv.FormatUint(id, 10))
+}
+
+// Call invokes the method of service with the given args, and stores
+// the result into the value pointed by result. If result is nil, the
+// result of method is ignored. The error returned from server is
+// *Error, which implements anserpc.ResultError.
+func (c *Client) Call(ctx context.Context, group, service, version, method string, result interface{}, args ...interface{}) error {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+
+	msg, err := c.newMessage(group, service, version, method, args...)
+	if err != nil {
+		return err
+	}
+
+	resps, err := c.tp.send(ctx, []*jsonMessage{msg}, false)
+	if err != nil {
+		return err
+	}
+
+	for _, resp := range resps {
+		if resp != nil && resp.isResponseOf(msg) {
+			return resp.decodeResult(result)
+		}
+	}
+
+	// server fails to read the request, e.g. invalid request
+	if err := idlessError(resps); err != nil {
+		return err
+	}
+
+	return ErrMissingResult
+}
+
+// Notify sends a notification, which is a request without id. Server
+// runs the method but never responds to it.
+func (c *Client) Notify(ctx context.Context, group, service, version, method string, args ...interface{}) error {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+
+	msg, err := c.newMessage(group, service, version, method, args...)
+	if err != nil {
+		return err
+	}
+
+	msg.ID = nil
+	resps, err := c.tp.send(ctx, []*jsonMessage{msg}, false)
+	if err != nil {
+		return err
+	}
+
+	// e.g. request is rejected by authentication
+	return idlessError(resps)
+}
+
+type BatchElem struct {
+	Group   string
+	Service string
+	Version string
+	Method  string
+	Args    []interface{}
+	// the element is sent as a notification if it is true
+	Notify bool
+	// the result of method is stored into Result if it is not nil
+	Result interface{}
+	// the error of method, it is set after BatchCall returns
+	Error error
+}
+
+// BatchCall sends all elements in a single request, and waits for all
+// of them. Error of each element is set to BatchElem.Error, the returned
+// error is for the failure of sending request, or the error response
+// without id if server fails to read the whole batch.
+func (c *Client) BatchCall(ctx context.Context, elems []*BatchElem) error {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+
+	if len(elems) == 0 {
+		return nil
+	}
+
+	msgs := make([]*jsonMessage, len(elems))
+	for i, elem := range elems {
+		msg, err := c.newMessage(elem.Group, elem.Service, elem.Version,
+			elem.Method, elem.Args...)
+		if err != nil {
+			return err
+		}
+
+		if elem.Notify {
+			msg.ID = nil
+		}
+
+		msgs[i] = msg
+	}
+
+	resps, err := c.tp.send(ctx, msgs, true)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*jsonMessage, len(resps))
+	for _, resp := range resps {
+		if resp != nil && resp.hasID() {
+			byID[string(resp.ID)] = resp
+		}
+	}
+
+	if len(byID) == 0 && len(resps) != 0 {
+		if err := idlessError(resps); err != nil {
+			return err
+		}
+	}
+
+	for i, elem := range elems {
+		if elem.Notify {
+			continue
+		}
+
+		resp, ok := byID[string(msgs[i].ID)]
+		if !ok {
+			elem.Error = ErrMissingResult
+			continue
+		}
+
+		elem.Error = resp.decodeResult(elem.Result)
+	}
+
+	return nil
+}
@@ -0,0 +1,494 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chao77977/anserpc"
+	"github.com/chao77977/anserpc/client"
+)
+
+var (
+	_urls    []string
+	_clients = make(map[string]*client.Client)
+	_network = &network{}
+	_ticker  = &ticker{ended: make(chan struct{}, 10)}
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Crit(msg string, ctx ...interface{})  {}
+func (nopLogger) Warn(msg string, ctx ...interface{})  {}
+func (nopLogger) Error(msg string, ctx ...interface{}) {}
+func (nopLogger) Info(msg string, ctx ...interface{})  {}
+func (nopLogger) Debug(msg string, ctx ...interface{}) {}
+
+type network struct {
+	touched int64
+}
+
+func (n *network) Touch() { atomic.AddInt64(&n.touched, 1) }
+
+func (n *network) IP() (string, error) { return "10.0.0.2", nil }
+
+func (n *network) Add(a, b int) (int, error) { return a + b, nil }
+
+func (n *network) Ping() error { return &pingErr{} }
+
+func (n *network) Sleep(d int) error {
+	time.Sleep(time.Duration(d) * time.Millisecond)
+	return nil
+}
+
+type ticker struct {
+	ended chan struct{}
+}
+
+func (t *ticker) Count(ctx context.Context, n int) (*anserpc.Subscription, error) {
+	ntf, ok := anserpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, errors.New("notifier not found")
+	}
+
+	sub := ntf.CreateSubscription()
+	go func() {
+		for i := 0; i < n; i++ {
+			ntf.Notify(sub.ID, i)
+		}
+
+		<-sub.Err()
+		t.ended <- struct{}{}
+	}()
+
+	return sub, nil
+}
+
+type pingErr struct{}
+
+func (e *pingErr) Error() string          { return e.ErrorMessage() }
+func (e *pingErr) ErrorCode() int         { return -1 }
+func (e *pingErr) ErrorMessage() string   { return "unknown host" }
+func (e *pingErr) ErrorData() interface{} { return map[string]string{"host": "10.0.0.3"} }
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// dialAll connects to each url once the server is ready, the clients
+// are shared by all tests.
+func dialAll(urls []string) error {
+	for _, u := range urls {
+		var c *client.Client
+		for i := 0; i < 100 && c == nil; i++ {
+			if cc, err := client.Dial(u); err == nil {
+				if cc.Call(context.Background(), "", "built-in", "1.0",
+					"Hello", nil) == nil {
+					c = cc
+					break
+				}
+
+				cc.Close()
+			}
+
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		if c == nil {
+			return fmt.Errorf("server on %s is not ready", u)
+		}
+
+		_clients[u] = c
+	}
+
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	port, err := freePort()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	dir, err := ioutil.TempDir("", "anserpc-client")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	sock := filepath.Join(dir, "anser.sock")
+	app := anserpc.New(
+		anserpc.WithRPCEndpoint("127.0.0.1", port),
+		anserpc.WithIPCEndpoint(sock),
+		anserpc.WithLoggerOpt(nopLogger{}),
+		anserpc.WithDisableInterruptHandler(),
+	)
+
+	app.Register("system", "network", "1.0", true, _network)
+	app.Register("system", "ticker", "1.0", true, _ticker)
+	app.RegisterAPI(&anserpc.API{
+		Group:      "system",
+		Service:    "calc",
+		Version:    "1.0",
+		Public:     true,
+		Receiver:   _network,
+		ParamNames: map[string][]string{"Add": {"a", "b"}},
+	})
+	go app.Run()
+
+	_urls = []string{
+		fmt.Sprintf("http://127.0.0.1:%d", port),
+		fmt.Sprintf("ws://127.0.0.1:%d", port),
+		sock,
+	}
+
+	if err := dialAll(_urls); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	for _, c := range _clients {
+		c.Close()
+	}
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func eachClient(t *testing.T, fn func(t *testing.T, c *client.Client)) {
+	for _, u := range _urls {
+		u := u
+		t.Run(u, func(t *testing.T) {
+			fn(t, _clients[u])
+		})
+	}
+}
+
+func TestCall(t *testing.T) {
+	eachClient(t, func(t *testing.T, c *client.Client) {
+		var ip string
+		if err := c.Call(context.Background(), "system", "network", "1.0",
+			"IP", &ip); err != nil {
+			t.Fatalf("call IP: %v", err)
+		}
+
+		if ip != "10.0.0.2" {
+			t.Errorf("IP = %q, want %q", ip, "10.0.0.2")
+		}
+
+		var sum int
+		if err := c.Call(context.Background(), "system", "network", "1.0",
+			"Add", &sum, 1, 2); err != nil {
+			t.Fatalf("call Add: %v", err)
+		}
+
+		if sum != 3 {
+			t.Errorf("Add = %d, want 3", sum)
+		}
+	})
+}
+
+func TestCallError(t *testing.T) {
+	eachClient(t, func(t *testing.T, c *client.Client) {
+		err := c.Call(context.Background(), "system", "network", "1.0",
+			"Ping", nil)
+
+		var rerr *client.Error
+		if !errors.As(err, &rerr) {
+			t.Fatalf("Ping error = %v (%T), want *client.Error", err, err)
+		}
+
+		var _ anserpc.ResultError = rerr
+		if rerr.ErrorCode() != -1 || rerr.ErrorMessage() != "unknown host" {
+			t.Errorf("Ping error = (%d, %q), want (-1, %q)",
+				rerr.ErrorCode(), rerr.ErrorMessage(), "unknown host")
+		}
+
+		data, ok := rerr.ErrorData().(map[string]interface{})
+		if !ok || data["host"] != "10.0.0.3" {
+			t.Errorf("Ping error data = %v, want host 10.0.0.3",
+				rerr.ErrorData())
+		}
+
+		err = c.Call(context.Background(), "system", "network", "1.0",
+			"NotFound", nil)
+		if !errors.As(err, &rerr) || rerr.ErrorCode() != -32601 {
+			t.Errorf("NotFound error = %v, want code -32601", err)
+		}
+	})
+}
+
+func TestBatchCall(t *testing.T) {
+	eachClient(t, func(t *testing.T, c *client.Client) {
+		elems := []*client.BatchElem{
+			{Group: "system", Service: "network", Version: "1.0",
+				Method: "Sleep", Args: []interface{}{50}},
+			{Group: "system", Service: "network", Version: "1.0",
+				Method: "Add", Args: []interface{}{1, 2}, Result: new(int)},
+			{Group: "system", Service: "network", Version: "1.0",
+				Method: "NotFound"},
+			{Group: "system", Service: "network", Version: "1.0",
+				Method: "Add", Args: []interface{}{3, 4}, Result: new(int)},
+			{Group: "system", Service: "network", Version: "1.0",
+				Method: "IP", Result: new(string)},
+		}
+
+		if err := c.BatchCall(context.Background(), elems); err != nil {
+			t.Fatalf("batch call: %v", err)
+		}
+
+		if elems[0].Error != nil {
+			t.Errorf("elem 0 error = %v", elems[0].Error)
+		}
+
+		if elems[1].Error != nil || *elems[1].Result.(*int) != 3 {
+			t.Errorf("elem 1 = (%v, %v), want 3", *elems[1].Result.(*int),
+				elems[1].Error)
+		}
+
+		var rerr *client.Error
+		if !errors.As(elems[2].Error, &rerr) || rerr.ErrorCode() != -32601 {
+			t.Errorf("elem 2 error = %v, want code -32601", elems[2].Error)
+		}
+
+		if elems[3].Error != nil || *elems[3].Result.(*int) != 7 {
+			t.Errorf("elem 3 = (%v, %v), want 7", *elems[3].Result.(*int),
+				elems[3].Error)
+		}
+
+		if elems[4].Error != nil || *elems[4].Result.(*string) != "10.0.0.2" {
+			t.Errorf("elem 4 = (%v, %v), want 10.0.0.2",
+				*elems[4].Result.(*string), elems[4].Error)
+		}
+	})
+}
+
+func TestCallContextCancel(t *testing.T) {
+	eachClient(t, func(t *testing.T, c *client.Client) {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := c.Call(ctx, "system", "network", "1.0", "Sleep", nil, 500)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+		}
+
+		if d := time.Since(start); d > 400*time.Millisecond {
+			t.Errorf("call returns after %v, want before method completes", d)
+		}
+	})
+}
+
+func TestDialUnknownScheme(t *testing.T) {
+	if _, err := client.Dial("ftp://127.0.0.1"); err == nil {
+		t.Error("dial ftp:// succeeded, want error")
+	}
+}
+
+func waitTouched(n int64) bool {
+	for i := 0; i < 100; i++ {
+		if atomic.LoadInt64(&_network.touched) >= n {
+			return true
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
+
+func TestNotify(t *testing.T) {
+	eachClient(t, func(t *testing.T, c *client.Client) {
+		n := atomic.LoadInt64(&_network.touched)
+		if err := c.Notify(context.Background(), "system", "network", "1.0",
+			"Touch"); err != nil {
+			t.Fatalf("notify: %v", err)
+		}
+
+		if !waitTouched(n + 1) {
+			t.Fatal("method of notification is not called")
+		}
+
+		// notifications in batch are not responded
+		elems := []*client.BatchElem{
+			{Group: "system", Service: "network", Version: "1.0",
+				Method: "Touch", Notify: true},
+			{Group: "system", Service: "network", Version: "1.0",
+				Method: "IP", Result: new(string)},
+		}
+
+		if err := c.BatchCall(context.Background(), elems); err != nil {
+			t.Fatalf("batch call: %v", err)
+		}
+
+		if elems[1].Error != nil || *elems[1].Result.(*string) != "10.0.0.2" {
+			t.Errorf("elem 1 = (%v, %v), want 10.0.0.2",
+				*elems[1].Result.(*string), elems[1].Error)
+		}
+
+		if !waitTouched(n + 2) {
+			t.Fatal("method of notification in batch is not called")
+		}
+	})
+}
+
+func TestNotifyNoContent(t *testing.T) {
+	body := `[{"jsonrpc":"2.0","group":"system","service":"network",` +
+		`"service_version":"1.0","method":"Touch"}]`
+	resp, err := http.Post(_urls[0], "application/json",
+		strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", resp.StatusCode,
+			http.StatusNoContent)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	for _, u := range _urls {
+		u, c := u, _clients[u]
+		t.Run(u, func(t *testing.T) {
+			testSubscribe(t, u, c)
+		})
+	}
+}
+
+func testSubscribe(t *testing.T, u string, c *client.Client) {
+	ch := make(chan int)
+	sub, err := c.Subscribe(context.Background(), "system", "ticker",
+		"1.0", "Count", ch, 3)
+	if strings.HasPrefix(u, "http") {
+		if err != client.ErrNotificationsUnsupported {
+			t.Errorf("subscribe over HTTP: %v, want %v", err,
+				client.ErrNotificationsUnsupported)
+		}
+
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	if sub.ID() == "" {
+		t.Error("subscription id is empty")
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case v := <-ch:
+			if v != i {
+				t.Errorf("notification %d = %d", i, v)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("notification %d is not received", i)
+		}
+	}
+
+	sub.Unsubscribe()
+	select {
+	case <-_ticker.ended:
+	case <-time.After(time.Second):
+		t.Error("subscription is not ended on server")
+	}
+
+	if _, ok := <-sub.Err(); ok {
+		t.Error("error channel is not closed after unsubscribe")
+	}
+}
+
+func TestCallNamedParams(t *testing.T) {
+	eachClient(t, func(t *testing.T, c *client.Client) {
+		var sum int
+		if err := c.Call(context.Background(), "system", "calc", "1.0",
+			"Add", &sum, client.NamedParams{"a": 1, "b": 2}); err != nil {
+			t.Fatalf("call Add: %v", err)
+		}
+
+		if sum != 3 {
+			t.Errorf("Add = %d, want 3", sum)
+		}
+	})
+}
+
+func TestAuthentication(t *testing.T) {
+	port, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := anserpc.New(
+		anserpc.WithRPCEndpoint("127.0.0.1", port),
+		anserpc.WithLoggerOpt(nopLogger{}),
+		anserpc.WithDisableInterruptHandler(),
+		anserpc.WithAuthOpt(anserpc.NewAPIKeyAuthenticator("",
+			map[string]*anserpc.Principal{"key-1": {Name: "bob"}})),
+	)
+
+	app.Register("system", "network", "1.0", true, _network)
+	go app.Run()
+
+	urls := []string{
+		fmt.Sprintf("http://127.0.0.1:%d", port),
+		fmt.Sprintf("ws://127.0.0.1:%d", port),
+	}
+
+	for _, u := range urls {
+		// retry until the server is ready
+		var ip string
+		for i := 0; i < 100; i++ {
+			var c *client.Client
+			if c, err = client.Dial(u, client.WithAPIKey("key-1")); err == nil {
+				err = c.Call(context.Background(), "system", "network",
+					"1.0", "IP", &ip)
+				c.Close()
+			}
+
+			if err == nil {
+				break
+			}
+
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		if err != nil || ip != "10.0.0.2" {
+			t.Fatalf("%s: authenticated call = %q %v", u, ip, err)
+		}
+
+		// websocket is rejected on dial, and http on call
+		c, err := client.Dial(u, client.WithAPIKey("key-2"))
+		if err == nil {
+			err = c.Call(context.Background(), "system", "network", "1.0",
+				"IP", &ip)
+			c.Close()
+		}
+
+		var rerr anserpc.ResultError
+		if !errors.As(err, &rerr) || rerr.ErrorCode() != -32013 {
+			t.Errorf("%s: unauthenticated call error = %v", u, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/chao77977/anserpc"
+)
+
+var _ anserpc.ResultError = (*Error)(nil)
+
+type jsonMessage struct {
+	Version        string          `json:"jsonrpc,omitempty"`
+	Group          string          `json:"group,omitempty"`
+	Service        string          `json:"service,omitempty"`
+	ServiceVersion string          `json:"service_version,omitempty"`
+	Method         string          `json:"method,omitempty"`
+	Params         json.RawMessage `json:"params,omitempty"`
+	ID             json.RawMessage `json:"id,omitempty"`
+	Result         json.RawMessage `json:"result,omitempty"`
+	Error          *Error          `json:"error,omitempty"`
+}
+
+func (m *jsonMessage) hasID() bool {
+	return len(m.ID) != 0 && !bytes.Equal(m.ID, []byte("null"))
+}
+
+// isNotification reports whether m is a notification of subscription
+func (m *jsonMessage) isNotification() bool {
+	return !m.hasID() && m.Method == _notificationMethod
+}
+
+func (m *jsonMessage) isResponseOf(req *jsonMessage) bool {
+	return bytes.Equal(m.ID, req.ID)
+}
+
+// idlessError returns the error of response without id, server replies
+// it once the request can not be read.
+func idlessError(resps []*jsonMessage) error {
+	for _, resp := range resps {
+		if resp != nil && !resp.hasID() && resp.Error != nil {
+			return resp.Error
+		}
+	}
+
+	return nil
+}
+
+func (m *jsonMessage) decodeResult(result interface{}) error {
+	if m.Error != nil {
+		return m.Error
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if len(m.Result) == 0 {
+		return ErrNoResult
+	}
+
+	return json.Unmarshal(m.Result, result)
+}
+
+type subscriptionResult struct {
+	ID     string          `json:"subscription"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Error is the error object of JSON-RPC response.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) ErrorCode() int {
+	return e.Code
+}
+
+func (e *Error) Error() string {
+	return e.ErrorMessage()
+}
+
+func (e *Error) ErrorMessage() string {
+	return e.Message
+}
+
+func (e *Error) ErrorData() interface{} {
+	return e.Data
+}
+
+func isBatchMessage(raw json.RawMessage) bool {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	return len(raw) > 0 && raw[0] == '['
+}
+
+func parseMessages(raw json.RawMessage) ([]*jsonMessage, error) {
+	if !isBatchMessage(raw) {
+		var msg jsonMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, err
+		}
+
+		return []*jsonMessage{&msg}, nil
+	}
+
+	var msgs []*jsonMessage
+	if err := json.Unmarshal(raw, &msgs); err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+func encodeMessages(msgs []*jsonMessage, isBatch bool) ([]byte, error) {
+	if isBatch {
+		return json.Marshal(msgs)
+	}
+
+	return json.Marshal(msgs[0])
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	_defAppJson           = "application/json"
+	_maxRespContentLength = 1024 * 1024 * 5
+)
+
+type httpTransport struct {
+	url    string
+	header http.Header
+	client *http.Client
+}
+
+func newHTTPTransport(url string, cfg *dialConfig) (*httpTransport, error) {
+	client := new(http.Client)
+	if cfg.tlsConfig != nil {
+		client.Transport = &http.Transport{TLSClientConfig: cfg.tlsConfig}
+	}
+
+	return &httpTransport{
+		url:    url,
+		header: cfg.header,
+		client: client,
+	}, nil
+}
+
+func (h *httpTransport) send(ctx context.Context, msgs []*jsonMessage, isBatch bool) ([]*jsonMessage, error) {
+	body, err := encodeMessages(msgs, isBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	for k, v := range h.header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("Content-Type", _defAppJson)
+	req.Header.Set("Accept", _defAppJson)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, _maxRespContentLength))
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing is responded to notifications
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// error response of server, e.g. unauthenticated
+		if msgs, err := parseMessages(data); err == nil && idlessError(msgs) != nil {
+			return msgs, nil
+		}
+
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	return parseMessages(data)
+}
+
+func (h *httpTransport) close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
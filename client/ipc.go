@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+)
+
+// ipcConn is a persistent unix socket connection, server keeps it
+// until client closes it.
+type ipcConn struct {
+	conn net.Conn
+	dec  *json.Decoder
+}
+
+func newIPCTransport(ctx context.Context, path string) (*streamTransport, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newIPCConnTransport(conn), nil
+}
+
+func newIPCConnTransport(conn net.Conn) *streamTransport {
+	return newStreamTransport(&ipcConn{
+		conn: conn,
+		dec:  json.NewDecoder(conn),
+	})
+}
+
+func (i *ipcConn) readMessage() (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := i.dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+func (i *ipcConn) writeMessage(ctx context.Context, b []byte) error {
+	deadline, _ := ctx.Deadline()
+	i.conn.SetWriteDeadline(deadline)
+	_, err := i.conn.Write(b)
+	return err
+}
+
+func (i *ipcConn) close() error {
+	return i.conn.Close()
+}
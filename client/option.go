@@ -0,0 +1,40 @@
+package client
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+type dialConfig struct {
+	header    http.Header
+	tlsConfig *tls.Config
+}
+
+// DialOption configures the connection of client.
+type DialOption func(*dialConfig)
+
+// WithHeader sets the header sent with HTTP requests and Websocket
+// upgrade request, it is ignored by IPC.
+func WithHeader(key, value string) DialOption {
+	return func(c *dialConfig) {
+		c.header.Set(key, value)
+	}
+}
+
+// WithBearerToken sets header "Authorization: Bearer <token>".
+func WithBearerToken(token string) DialOption {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithAPIKey sets header "X-API-Key: <key>".
+func WithAPIKey(key string) DialOption {
+	return WithHeader("X-API-Key", key)
+}
+
+// WithTLSConfig sets TLS config of https and wss, e.g. root CAs of server
+// and client certificate(mTLS).
+func WithTLSConfig(config *tls.Config) DialOption {
+	return func(c *dialConfig) {
+		c.tlsConfig = config
+	}
+}
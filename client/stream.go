@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// streamConn is a persistent connection, e.g. Websocket and IPC.
+type streamConn interface {
+	readMessage() (json.RawMessage, error)
+	writeMessage(ctx context.Context, b []byte) error
+	close() error
+}
+
+type pendingCall struct {
+	c   chan *jsonMessage
+	sub *ClientSubscription
+}
+
+// streamTransport sends requests on a persistent connection, and
+// dispatches responses by id. It also receives notifications of
+// subscriptions.
+type streamTransport struct {
+	conn streamConn
+	wmu  sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]*pendingCall
+	subs    map[string]*ClientSubscription
+	err     error
+	closeC  chan struct{}
+}
+
+func newStreamTransport(conn streamConn) *streamTransport {
+	s := &streamTransport{
+		conn:    conn,
+		pending: make(map[string]*pendingCall),
+		subs:    make(map[string]*ClientSubscription),
+		closeC:  make(chan struct{}),
+	}
+
+	go s.read()
+	return s
+}
+
+func (s *streamTransport) read() {
+	var err error
+	defer func() {
+		s.mu.Lock()
+		s.err = err
+		if s.err == nil {
+			s.err = ErrClientClosed
+		}
+
+		for id, sub := range s.subs {
+			delete(s.subs, id)
+			sub.finish(s.err)
+		}
+
+		close(s.closeC)
+		s.mu.Unlock()
+	}()
+
+	for {
+		var data json.RawMessage
+		if data, err = s.conn.readMessage(); err != nil {
+			return
+		}
+
+		msgs, perr := parseMessages(data)
+		if perr != nil {
+			continue
+		}
+
+		s.dispatch(msgs)
+	}
+}
+
+func (s *streamTransport) dispatch(msgs []*jsonMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+
+		if msg.isNotification() {
+			s.notify(msg)
+			continue
+		}
+
+		// the response without id can not be matched to any request,
+		// fail all pending requests with it
+		if !msg.hasID() {
+			for id, p := range s.pending {
+				delete(s.pending, id)
+				p.c <- msg
+			}
+
+			continue
+		}
+
+		id := string(msg.ID)
+		p, ok := s.pending[id]
+		if !ok {
+			continue
+		}
+
+		delete(s.pending, id)
+		if p.sub != nil && msg.Error == nil {
+			// register subscription before any of its notifications
+			if err := json.Unmarshal(msg.Result, &p.sub.id); err == nil {
+				s.subs[p.sub.id] = p.sub
+			}
+		}
+
+		p.c <- msg
+	}
+}
+
+func (s *streamTransport) notify(msg *jsonMessage) {
+	var result subscriptionResult
+	if err := json.Unmarshal(msg.Params, &result); err != nil {
+		return
+	}
+
+	sub, ok := s.subs[result.ID]
+	if !ok {
+		return
+	}
+
+	if !sub.deliver(result.Result) {
+		delete(s.subs, result.ID)
+		sub.finish(ErrSubscriptionQueueOverflow)
+	}
+}
+
+func (s *streamTransport) register(msgs []*jsonMessage, sub *ClientSubscription) ([]chan *jsonMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	cs := make([]chan *jsonMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		// no response to notification
+		if !msg.hasID() {
+			continue
+		}
+
+		c := make(chan *jsonMessage, 1)
+		s.pending[string(msg.ID)] = &pendingCall{c: c, sub: sub}
+		cs = append(cs, c)
+	}
+
+	return cs, nil
+}
+
+func (s *streamTransport) unregister(msgs []*jsonMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range msgs {
+		delete(s.pending, string(msg.ID))
+	}
+}
+
+func (s *streamTransport) removeSubscription(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subs, id)
+}
+
+func (s *streamTransport) send(ctx context.Context, msgs []*jsonMessage, isBatch bool) ([]*jsonMessage, error) {
+	return s.sendWith(ctx, msgs, isBatch, nil)
+}
+
+func (s *streamTransport) sendWith(ctx context.Context, msgs []*jsonMessage, isBatch bool, sub *ClientSubscription) ([]*jsonMessage, error) {
+	body, err := encodeMessages(msgs, isBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := s.register(msgs, sub)
+	if err != nil {
+		return nil, err
+	}
+	defer s.unregister(msgs)
+
+	s.wmu.Lock()
+	err = s.conn.writeMessage(ctx, body)
+	s.wmu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	resps := make([]*jsonMessage, 0, len(cs))
+	for _, c := range cs {
+		select {
+		case resp := <-c:
+			resps = append(resps, resp)
+		case <-s.closeC:
+			return nil, s.closedErr()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return resps, nil
+}
+
+func (s *streamTransport) closedErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *streamTransport) close() error {
+	s.wmu.Lock()
+	err := s.conn.close()
+	s.wmu.Unlock()
+
+	<-s.closeC
+	return err
+}
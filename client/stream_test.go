@@ -0,0 +1,48 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDispatchWithoutID(t *testing.T) {
+	w := &streamTransport{
+		pending: make(map[string]*pendingCall),
+	}
+
+	reqs := []*jsonMessage{
+		{ID: json.RawMessage("1")},
+		{ID: json.RawMessage("2")},
+	}
+
+	cs, err := w.register(reqs, nil)
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	msgs, err := parseMessages([]byte(
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"}}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	w.dispatch(msgs)
+	for i, c := range cs {
+		select {
+		case msg := <-c:
+			if msg.Error == nil || msg.Error.Code != -32600 {
+				t.Errorf("request %d: got %+v, want error -32600", i, msg)
+			}
+		default:
+			t.Errorf("request %d: response without id is not dispatched", i)
+		}
+	}
+
+	if len(w.pending) != 0 {
+		t.Errorf("pending = %d, want 0", len(w.pending))
+	}
+
+	if err := idlessError(msgs); err == nil {
+		t.Error("idlessError = nil, want error")
+	}
+}
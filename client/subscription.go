@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	_maxSubscriptionBuffer = 1000
+	_unsubscribeTimeout    = 5 * time.Second
+)
+
+// ClientSubscription is a subscription created by Client.Subscribe,
+// notifications are delivered to the channel given to Subscribe.
+type ClientSubscription struct {
+	c       *Client
+	tp      *streamTransport
+	group   string
+	service string
+	version string
+	id      string
+
+	channel reflect.Value
+	in      chan json.RawMessage
+	err     chan error
+	quit    chan struct{}
+	once    sync.Once
+}
+
+// Subscribe calls the method which returns subscription by built-in
+// method "subscribe", and delivers the results of notifications to ch,
+// which must be a channel. It is only supported on Websocket and IPC.
+func (c *Client) Subscribe(ctx context.Context, group, service, version, method string, ch interface{}, args ...interface{}) (*ClientSubscription, error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+
+	tp, ok := c.tp.(*streamTransport)
+	if !ok {
+		return nil, ErrNotificationsUnsupported
+	}
+
+	chVal := reflect.ValueOf(ch)
+	if chVal.Kind() != reflect.Chan || chVal.Type().ChanDir()&reflect.SendDir == 0 {
+		return nil, errors.New("the argument of subscription is not a writable channel")
+	}
+
+	msg, err := c.newMessage(group, service, version, _subscribeMethod,
+		append([]interface{}{method}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &ClientSubscription{
+		c:       c,
+		tp:      tp,
+		group:   group,
+		service: service,
+		version: version,
+		channel: chVal,
+		in:      make(chan json.RawMessage, _maxSubscriptionBuffer),
+		err:     make(chan error, 1),
+		quit:    make(chan struct{}),
+	}
+
+	resps, err := tp.sendWith(ctx, []*jsonMessage{msg}, false, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resps) == 0 || resps[0] == nil {
+		return nil, ErrMissingResult
+	}
+
+	if resps[0].Error != nil {
+		return nil, resps[0].Error
+	}
+
+	if sub.id == "" {
+		return nil, ErrNoResult
+	}
+
+	go sub.run()
+	return sub, nil
+}
+
+func (s *ClientSubscription) ID() string {
+	return s.id
+}
+
+// Err returns a channel, the error is sent on it once the subscription
+// is ended by server or connection. It is closed on Unsubscribe.
+func (s *ClientSubscription) Err() <-chan error {
+	return s.err
+}
+
+// Unsubscribe tells server to stop the subscription, it is safe to be
+// called more than once.
+func (s *ClientSubscription) Unsubscribe() {
+	select {
+	case <-s.quit:
+		return
+	default:
+	}
+
+	s.tp.removeSubscription(s.id)
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		_unsubscribeTimeout)
+	defer cancel()
+
+	params, _ := json.Marshal([]string{s.id})
+	msg := &jsonMessage{
+		Version:        _defJsonRpcVersion,
+		Group:          s.group,
+		Service:        s.service,
+		ServiceVersion: s.version,
+		Method:         _unsubscribeMethod,
+		Params:         params,
+		ID:             s.c.newID(),
+	}
+
+	s.tp.send(ctx, []*jsonMessage{msg}, false)
+	s.finish(nil)
+}
+
+// deliver queues result of notification, it returns false if the
+// queue is full.
+func (s *ClientSubscription) deliver(result json.RawMessage) bool {
+	select {
+	case s.in <- result:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ClientSubscription) finish(err error) {
+	s.once.Do(func() {
+		if err != nil {
+			s.err <- err
+		}
+
+		close(s.err)
+		close(s.quit)
+	})
+}
+
+func (s *ClientSubscription) run() {
+	elemType := s.channel.Type().Elem()
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.quit)},
+		{Dir: reflect.SelectSend, Chan: s.channel},
+	}
+
+	for {
+		var result json.RawMessage
+		select {
+		case result = <-s.in:
+		case <-s.quit:
+			return
+		}
+
+		v := reflect.New(elemType)
+		if err := json.Unmarshal(result, v.Interface()); err != nil {
+			continue
+		}
+
+		cases[1].Send = v.Elem()
+		if chosen, _, _ := reflect.Select(cases); chosen == 0 {
+			return
+		}
+	}
+}
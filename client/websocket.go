@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/gorilla/websocket"
+)
+
+type websocketConn struct {
+	conn *websocket.Conn
+}
+
+func newWebsocketTransport(ctx context.Context, url string, cfg *dialConfig) (*streamTransport, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = cfg.tlsConfig
+
+	conn, resp, err := dialer.DialContext(ctx, url, cfg.header)
+	if err != nil {
+		// error response of upgrade request, e.g. unauthenticated
+		if resp != nil && resp.Body != nil {
+			data, _ := ioutil.ReadAll(resp.Body)
+			if msgs, perr := parseMessages(data); perr == nil {
+				if rerr := idlessError(msgs); rerr != nil {
+					return nil, rerr
+				}
+			}
+		}
+
+		return nil, err
+	}
+
+	conn.SetReadLimit(_maxRespContentLength)
+	return newStreamTransport(&websocketConn{conn: conn}), nil
+}
+
+func (w *websocketConn) readMessage() (json.RawMessage, error) {
+	_, data, err := w.conn.ReadMessage()
+	return data, err
+}
+
+func (w *websocketConn) writeMessage(ctx context.Context, b []byte) error {
+	// deadline of the previous request must not be left
+	deadline, _ := ctx.Deadline()
+	w.conn.SetWriteDeadline(deadline)
+	return w.conn.WriteMessage(websocket.TextMessage, b)
+}
+
+func (w *websocketConn) close() error {
+	w.conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return w.conn.Close()
+}
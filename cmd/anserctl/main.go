@@ -0,0 +1,525 @@
+/*
+Command anserctl calls and inspects anserpc servers over HTTP, Websocket
+and IPC.
+
+	anserctl [flags] call <[group/]service[@version].method> [params...]
+	anserctl [flags] batch <file>
+	anserctl [flags] list
+
+Params are positional JSON values, e.g. 1 '"a b"' '[1,2]', a value which
+is not JSON is sent as a string, and all values are sent as strings with
+-string, e.g. true and 123. Params of "name=value" are sent as named
+params. The batch file is a JSON array of calls, "-" is stdin,
+
+	[{"call": "system/calc@1.0.add", "params": {"a": 1, "b": 2}},
+	 {"call": "system/network.touch", "notify": true}]
+
+It exits with 1 if any call fails, and 2 if the request is not sent.
+*/
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chao77977/anserpc"
+	"github.com/chao77977/anserpc/client"
+)
+
+const (
+	_defURL     = "http://127.0.0.1:56789"
+	_defTimeout = 30 * time.Second
+
+	_exitOK       = 0
+	_exitRPCError = 1
+	_exitUsage    = 2
+)
+
+var _paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+type headers []string
+
+func (h *headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headers) Set(v string) error {
+	if !strings.Contains(v, ":") {
+		return fmt.Errorf("header %q is not \"key: value\"", v)
+	}
+
+	*h = append(*h, v)
+	return nil
+}
+
+// target is the method addressed by [group/]service[@version].method
+type target struct {
+	group   string
+	service string
+	version string
+	method  string
+}
+
+func parseTarget(s string) (*target, error) {
+	i := strings.LastIndex(s, ".")
+	if i <= 0 || i == len(s)-1 {
+		return nil, fmt.Errorf("invalid method %q, want [group/]service[@version].method", s)
+	}
+
+	t := &target{method: s[i+1:]}
+	name := s[:i]
+	if i := strings.Index(name, "/"); i >= 0 {
+		t.group, name = name[:i], name[i+1:]
+	}
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		t.version, name = name[i+1:], name[:i]
+	}
+
+	if t.service = name; name == "" {
+		return nil, fmt.Errorf("invalid method %q, service is empty", s)
+	}
+
+	return t, nil
+}
+
+func (t *target) String() string {
+	s := t.service
+	if t.group != "" {
+		s = t.group + "/" + s
+	}
+
+	if t.version != "" {
+		s += "@" + t.version
+	}
+
+	return s + "." + t.method
+}
+
+// jsonValue returns s if it is JSON, or s as a JSON string. s is always
+// a JSON string if str is true.
+func jsonValue(s string, str bool) json.RawMessage {
+	if !str && json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// parseParams returns args of call, they are named params if all of them
+// are "name=value". Values are sent as strings if str is true.
+func parseParams(args []string, str bool) ([]interface{}, error) {
+	named := 0
+	for _, arg := range args {
+		if _paramName.MatchString(arg) {
+			named++
+		}
+	}
+
+	if named == 0 {
+		params := make([]interface{}, len(args))
+		for i, arg := range args {
+			params[i] = jsonValue(arg, str)
+		}
+
+		return params, nil
+	}
+
+	if named != len(args) {
+		return nil, errors.New("positional and named params are mixed")
+	}
+
+	params := make(client.NamedParams, len(args))
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		params[arg[:i]] = jsonValue(arg[i+1:], str)
+	}
+
+	return []interface{}{params}, nil
+}
+
+// paramsArgs converts params of JSON array or object to args of call
+func paramsArgs(params json.RawMessage) ([]interface{}, error) {
+	if len(params) == 0 || string(params) == "null" {
+		return nil, nil
+	}
+
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(params, &named); err == nil {
+		args := make(client.NamedParams, len(named))
+		for k, v := range named {
+			args[k] = v
+		}
+
+		return []interface{}{args}, nil
+	}
+
+	var positional []json.RawMessage
+	if err := json.Unmarshal(params, &positional); err != nil {
+		return nil, errors.New("params is neither an array nor an object")
+	}
+
+	args := make([]interface{}, len(positional))
+	for i, v := range positional {
+		args[i] = v
+	}
+
+	return args, nil
+}
+
+// rpcError is printed for errors of calls
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func toRPCError(err error) *rpcError {
+	if e, ok := err.(anserpc.ResultError); ok {
+		return &rpcError{
+			Code:    e.ErrorCode(),
+			Message: e.ErrorMessage(),
+			Data:    e.ErrorData(),
+		}
+	}
+
+	return &rpcError{Message: err.Error()}
+}
+
+// tlsConfig returns config of https and wss, it is nil if none of the
+// files is given and verification is not skipped.
+func tlsConfig(caFile, certFile, keyFile string, insecure bool) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" && !insecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		b, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate in CA file %q", caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+type ctl struct {
+	c       *client.Client
+	timeout time.Duration
+	compact bool
+	str     bool
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+func (c *ctl) print(w io.Writer, v interface{}) {
+	var b []byte
+	if c.compact {
+		b, _ = json.Marshal(v)
+	} else {
+		b, _ = json.MarshalIndent(v, "", "  ")
+	}
+
+	fmt.Fprintln(w, string(b))
+}
+
+func (c *ctl) printError(err error) {
+	e := toRPCError(err)
+	fmt.Fprintf(c.stderr, "error %d: %s\n", e.Code, e.Message)
+	if e.Data != nil {
+		c.print(c.stderr, e.Data)
+	}
+}
+
+func (c *ctl) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+func (c *ctl) call(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(c.stderr, "call: method is required")
+		return _exitUsage
+	}
+
+	t, err := parseTarget(args[0])
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return _exitUsage
+	}
+
+	params, err := parseParams(args[1:], c.str)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return _exitUsage
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	var result json.RawMessage
+	err = c.c.Call(ctx, t.group, t.service, t.version, t.method, &result, params...)
+	if err != nil {
+		c.printError(err)
+		if _, ok := err.(anserpc.ResultError); ok {
+			return _exitRPCError
+		}
+
+		return _exitUsage
+	}
+
+	c.print(c.stdout, result)
+	return _exitOK
+}
+
+type batchCall struct {
+	Call   string          `json:"call"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Notify bool            `json:"notify,omitempty"`
+}
+
+type batchResult struct {
+	Call   string          `json:"call"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *rpcError       `json:"error,omitempty"`
+}
+
+func (c *ctl) batch(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(c.stderr, "batch: a file is required")
+		return _exitUsage
+	}
+
+	var b []byte
+	var err error
+	if args[0] == "-" {
+		b, err = ioutil.ReadAll(c.stdin)
+	} else {
+		b, err = ioutil.ReadFile(args[0])
+	}
+
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return _exitUsage
+	}
+
+	var calls []*batchCall
+	if err := json.Unmarshal(b, &calls); err != nil {
+		fmt.Fprintf(c.stderr, "batch: invalid file: %v\n", err)
+		return _exitUsage
+	}
+
+	elems := make([]*client.BatchElem, len(calls))
+	results := make([]json.RawMessage, len(calls))
+	for i, call := range calls {
+		t, err := parseTarget(call.Call)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "batch: call %d: %v\n", i, err)
+			return _exitUsage
+		}
+
+		params, err := paramsArgs(call.Params)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "batch: call %d: %v\n", i, err)
+			return _exitUsage
+		}
+
+		elems[i] = &client.BatchElem{
+			Group:   t.group,
+			Service: t.service,
+			Version: t.version,
+			Method:  t.method,
+			Args:    params,
+			Notify:  call.Notify,
+			Result:  &results[i],
+		}
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	if err := c.c.BatchCall(ctx, elems); err != nil {
+		c.printError(err)
+		return _exitUsage
+	}
+
+	code := _exitOK
+	out := make([]*batchResult, 0, len(calls))
+	for i, elem := range elems {
+		if elem.Notify {
+			continue
+		}
+
+		r := &batchResult{Call: calls[i].Call, Result: results[i]}
+		if elem.Error != nil {
+			r.Result = nil
+			r.Error = toRPCError(elem.Error)
+			code = _exitRPCError
+		}
+
+		out = append(out, r)
+	}
+
+	c.print(c.stdout, out)
+	return code
+}
+
+// list prints methods available to the caller, they are discovered by
+// built-in method rpc.discover.
+func (c *ctl) list(args []string) int {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	var doc anserpc.OpenRPC
+	if err := c.c.Call(ctx, "", "", "", "rpc.discover", &doc); err != nil {
+		c.printError(err)
+		if _, ok := err.(anserpc.ResultError); ok {
+			return _exitRPCError
+		}
+
+		return _exitUsage
+	}
+
+	for _, m := range doc.Methods {
+		t := &target{group: m.Group, service: m.Service, version: m.Version,
+			method: m.Method}
+
+		names := make([]string, len(m.Params))
+		for i, p := range m.Params {
+			names[i] = p.Name
+		}
+
+		line := fmt.Sprintf("%s(%s)", t, strings.Join(names, ", "))
+		if m.Subscription {
+			line += " subscription"
+		}
+
+		if !m.Public {
+			line += " private"
+		}
+
+		fmt.Fprintln(c.stdout, line)
+	}
+
+	return _exitOK
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("anserctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: anserctl [flags] call <[group/]service[@version].method> [params...]")
+		fmt.Fprintln(stderr, "       anserctl [flags] batch <file>")
+		fmt.Fprintln(stderr, "       anserctl [flags] list")
+		fs.PrintDefaults()
+	}
+
+	var hdrs headers
+	url := fs.String("url", _defURL, "server url, http(s)://, ws(s):// or path of IPC socket")
+	token := fs.String("token", "", "bearer token")
+	timeout := fs.Duration("timeout", _defTimeout, "timeout of request")
+	compact := fs.Bool("compact", false, "print JSON without indent")
+	str := fs.Bool("string", false, "send params of call as strings")
+	caFile := fs.String("cacert", "", "CA file to verify server of https and wss")
+	certFile := fs.String("cert", "", "client certificate file of mTLS")
+	keyFile := fs.String("key", "", "client key file of mTLS")
+	insecure := fs.Bool("insecure", false, "skip verification of server certificate")
+	fs.Var(&hdrs, "H", "header of HTTP and Websocket, \"key: value\", can be repeated")
+
+	if err := fs.Parse(args); err != nil {
+		return _exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return _exitUsage
+	}
+
+	var opts []client.DialOption
+	for _, h := range hdrs {
+		i := strings.Index(h, ":")
+		opts = append(opts, client.WithHeader(strings.TrimSpace(h[:i]),
+			strings.TrimSpace(h[i+1:])))
+	}
+
+	if *token != "" {
+		opts = append(opts, client.WithBearerToken(*token))
+	}
+
+	config, err := tlsConfig(*caFile, *certFile, *keyFile, *insecure)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return _exitUsage
+	}
+
+	if config != nil {
+		opts = append(opts, client.WithTLSConfig(config))
+	}
+
+	c := &ctl{
+		timeout: *timeout,
+		compact: *compact,
+		str:     *str,
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+
+	var cmd func(args []string) int
+	switch fs.Arg(0) {
+	case "call":
+		cmd = c.call
+	case "batch":
+		cmd = c.batch
+	case "list":
+		cmd = c.list
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return _exitUsage
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	cl, err := client.DialContext(ctx, *url, opts...)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return _exitUsage
+	}
+	defer cl.Close()
+
+	c.c = cl
+	return cmd(fs.Args()[1:])
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chao77977/anserpc"
+	"github.com/chao77977/anserpc/client"
+)
+
+var _sock string
+
+type nopLogger struct{}
+
+func (nopLogger) Crit(msg string, ctx ...interface{})  {}
+func (nopLogger) Warn(msg string, ctx ...interface{})  {}
+func (nopLogger) Error(msg string, ctx ...interface{}) {}
+func (nopLogger) Info(msg string, ctx ...interface{})  {}
+func (nopLogger) Debug(msg string, ctx ...interface{}) {}
+
+type calc struct{}
+
+func (c *calc) Add(a, b int) (int, error) { return a + b, nil }
+
+func (c *calc) Div(a, b int) (int, error) {
+	if b == 0 {
+		return 0, &divErr{}
+	}
+
+	return a / b, nil
+}
+
+type divErr struct{}
+
+func (e *divErr) Error() string          { return e.ErrorMessage() }
+func (e *divErr) ErrorCode() int         { return -1 }
+func (e *divErr) ErrorMessage() string   { return "division by zero" }
+func (e *divErr) ErrorData() interface{} { return map[string]int{"b": 0} }
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "anserctl")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	_sock = filepath.Join(dir, "anser.sock")
+	app := anserpc.New(
+		anserpc.WithIPCEndpoint(_sock),
+		anserpc.WithLoggerOpt(nopLogger{}),
+		anserpc.WithDisableInterruptHandler(),
+	)
+
+	app.RegisterAPI(&anserpc.API{
+		Group:      "system",
+		Service:    "calc",
+		Version:    "1.0",
+		Public:     true,
+		Receiver:   &calc{},
+		ParamNames: map[string][]string{"Add": {"a", "b"}, "Div": {"a", "b"}},
+	})
+	go app.Run()
+
+	for i := 0; ; i++ {
+		if conn, err := net.Dial("unix", _sock); err == nil {
+			conn.Close()
+			break
+		}
+
+		if i == 100 {
+			fmt.Fprintln(os.Stderr, "server is not ready")
+			os.Exit(1)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	code := m.Run()
+	app.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func runCtl(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-url", _sock, "-compact"}, args...)
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String())
+}
+
+func TestParseTarget(t *testing.T) {
+	for s, want := range map[string]*target{
+		"network.ip":              {service: "network", method: "ip"},
+		"system/network.ip":       {group: "system", service: "network", method: "ip"},
+		"system/network@1.0.ip":   {group: "system", service: "network", version: "1.0", method: "ip"},
+		"network@2.ip":            {service: "network", version: "2", method: "ip"},
+		"built-in.Hello":          {service: "built-in", method: "Hello"},
+		"system/network@1.0.ip.x": {group: "system", service: "network", version: "1.0.ip", method: "x"},
+	} {
+		got, err := parseTarget(s)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parseTarget(%q) = %+v, %v, want %+v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"network", "network.", ".ip", "system/.ip"} {
+		if _, err := parseTarget(s); err == nil {
+			t.Errorf("parseTarget(%q), want error", s)
+		}
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	params, err := parseParams([]string{"1", "a b", `"c"`}, false)
+	if err != nil || fmt.Sprintf("%s", params) != `[1 "a b" "c"]` {
+		t.Errorf("positional params = %s, %v", params, err)
+	}
+
+	params, err = parseParams([]string{"a=1", "b=x"}, false)
+	named, ok := params[0].(client.NamedParams)
+	if err != nil || len(params) != 1 || !ok ||
+		fmt.Sprintf("%s %s", named["a"], named["b"]) != `1 "x"` {
+		t.Errorf("named params = %v, %v", params, err)
+	}
+
+	if _, err := parseParams([]string{"a=1", "2"}, false); err == nil {
+		t.Error("mixed params, want error")
+	}
+
+	// values of JSON are sent as strings with -string
+	params, err = parseParams([]string{"true", "123", "null", `"c"`}, true)
+	if err != nil || fmt.Sprintf("%s", params) != `["true" "123" "null" "\"c\""]` {
+		t.Errorf("string params = %s, %v", params, err)
+	}
+
+	params, err = parseParams([]string{"a=1"}, true)
+	if named, ok := params[0].(client.NamedParams); err != nil || !ok ||
+		fmt.Sprintf("%s", named["a"]) != `"1"` {
+		t.Errorf("named string params = %v, %v", params, err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	if config, err := tlsConfig("", "", "", false); config != nil || err != nil {
+		t.Errorf("config without flags = %v, %v, want nil", config, err)
+	}
+
+	if config, err := tlsConfig("", "", "", true); err != nil || !config.InsecureSkipVerify {
+		t.Errorf("config of insecure = %+v, %v", config, err)
+	}
+
+	dir, err := ioutil.TempDir("", "anserctl-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bad := filepath.Join(dir, "bad.pem")
+	ioutil.WriteFile(bad, []byte("not a certificate"), 0600)
+	for _, files := range [][3]string{
+		{bad, "", ""},
+		{filepath.Join(dir, "missing.pem"), "", ""},
+		{"", bad, bad},
+		{"", bad, ""},
+	} {
+		if _, err := tlsConfig(files[0], files[1], files[2], false); err == nil {
+			t.Errorf("config of %v, want error", files)
+		}
+	}
+
+	if code, _, errOut := runCtl("", "-cacert", bad, "list"); code != _exitUsage || errOut == "" {
+		t.Errorf("list with bad CA file = %d %q, want usage error", code, errOut)
+	}
+}
+
+func TestCall(t *testing.T) {
+	for _, args := range [][]string{
+		{"call", "system/calc@1.0.add", "1", "2"},
+		{"call", "system/calc.add", "a=1", "b=2"},
+	} {
+		code, out, errOut := runCtl("", args...)
+		if code != _exitOK || out != "3" {
+			t.Errorf("%v = %d %q %q, want 3", args, code, out, errOut)
+		}
+	}
+
+	code, _, errOut := runCtl("", "call", "system/calc.div", "1", "0")
+	if code != _exitRPCError || errOut != "error -1: division by zero\n{\"b\":0}" {
+		t.Errorf("call error = %d %q, want division by zero", code, errOut)
+	}
+
+	code, _, errOut = runCtl("", "call", "system/calc.unknown")
+	if code != _exitRPCError || !strings.HasPrefix(errOut, "error -32601") {
+		t.Errorf("call unknown method = %d %q, want method not found", code, errOut)
+	}
+
+	if code, _, _ := runCtl("", "call", "calc"); code != _exitUsage {
+		t.Errorf("call invalid method = %d, want usage error", code)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	code, out, errOut := runCtl(`[
+		{"call": "system/calc.add", "params": [1, 2]},
+		{"call": "system/calc.add", "params": {"a": 3, "b": 4}, "notify": true},
+		{"call": "system/calc.div", "params": {"a": 1, "b": 0}}
+	]`, "batch", "-")
+
+	want := `[{"call":"system/calc.add","result":3},` +
+		`{"call":"system/calc.div","error":{"code":-1,"message":"division by zero","data":{"b":0}}}]`
+	if code != _exitRPCError || out != want {
+		t.Errorf("batch = %d %q %q, want %s", code, out, errOut, want)
+	}
+}
+
+func TestList(t *testing.T) {
+	code, out, errOut := runCtl("", "list")
+	if code != _exitOK {
+		t.Fatalf("list = %d %q", code, errOut)
+	}
+
+	for _, want := range []string{"system/calc@1.0.add(a, b)", "built-in@1.0.rpc.discover()"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("list = %q, want %s", out, want)
+		}
+	}
+}
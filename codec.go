@@ -8,6 +8,8 @@ import (
 	"reflect"
 	"sync"
 	"time"
+
+	"github.com/chao77977/anserpc/util"
 )
 
 const (
@@ -32,13 +34,23 @@ func (m *jsonMessage) doValidate() error {
 		return _errProtoVersion
 	}
 
-	if m.Service == "" || m.Method == "" {
+	// "rpc.discover" of OpenRPC is called without service
+	if m.Method == "" || m.Service == "" && !m.isDiscover() {
 		return _errProtoServiceOrMethodNotFound
 	}
 
 	return nil
 }
 
+func (m *jsonMessage) isDiscover() bool {
+	return util.FormatName(m.Method) == _discoverMethod
+}
+
+// a notification is a request without id, server must not reply to it
+func (m *jsonMessage) isNotification() bool {
+	return len(m.ID) == 0
+}
+
 func (m *jsonMessage) hasErr() bool {
 	return m.Error != nil
 }
@@ -89,7 +101,10 @@ func zeroArgs(args []reflect.Value, types []reflect.Type) ([]reflect.Value, erro
 	return args, nil
 }
 
-func (m *jsonMessage) retrieveArgs(types []reflect.Type) ([]reflect.Value, error) {
+// retrieveArgs decodes params into args of method. Params can be an
+// array of positional args, or an object. The object is decoded into
+// the only struct arg of method, or mapped onto args by names.
+func (m *jsonMessage) retrieveArgs(types []reflect.Type, names []string) ([]reflect.Value, error) {
 	args := make([]reflect.Value, 0, len(types))
 	dec := json.NewDecoder(bytes.NewReader(m.Params))
 	tok, err := dec.Token()
@@ -101,12 +116,16 @@ func (m *jsonMessage) retrieveArgs(types []reflect.Type) ([]reflect.Value, error
 		return nil, _errInvalidParams
 	}
 
-	if tok != nil && tok != json.Delim('[') {
+	if tok == json.Delim('{') {
+		return m.retrieveNamedArgs(types, names)
+	}
+
+	if tok != json.Delim('[') {
 		return nil, _errInvalidParams
 	}
 
 	for i := 0; dec.More(); i++ {
-		if i > len(types) {
+		if i >= len(types) {
 			return nil, _errTooManyParams
 		}
 
@@ -130,6 +149,91 @@ func (m *jsonMessage) retrieveArgs(types []reflect.Type) ([]reflect.Value, error
 	return zeroArgs(args, types)
 }
 
+func isStructType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct
+}
+
+func (m *jsonMessage) retrieveNamedArgs(types []reflect.Type, names []string) ([]reflect.Value, error) {
+	if len(names) == 0 {
+		if len(types) != 1 || !isStructType(types[0]) {
+			return nil, _errInvalidParams
+		}
+
+		v := reflect.New(types[0])
+		if err := json.Unmarshal(m.Params, v.Interface()); err != nil {
+			return nil, _errInvalidParams
+		}
+
+		return []reflect.Value{v.Elem()}, nil
+	}
+
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(m.Params, &params); err != nil {
+		return nil, _errInvalidParams
+	}
+
+	if len(params) > len(names) {
+		return nil, _errTooManyParams
+	}
+
+	args := make([]reflect.Value, len(types))
+	for i, name := range names {
+		raw, ok := params[name]
+		if !ok {
+			if types[i].Kind() != reflect.Ptr {
+				return nil, _errMissingValueParams
+			}
+
+			args[i] = reflect.Zero(types[i])
+			continue
+		}
+
+		delete(params, name)
+		if bytes.Equal(raw, []byte("null")) && types[i].Kind() != reflect.Ptr {
+			return nil, _errMissingValueParams
+		}
+
+		v := reflect.New(types[i])
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return nil, _errInvalidParams
+		}
+
+		args[i] = v.Elem()
+	}
+
+	// unknown names
+	if len(params) != 0 {
+		return nil, _errInvalidParams
+	}
+
+	return args, nil
+}
+
+// subscriptionArgs returns the method name and its params of
+// subscription, params of "subscribe" is [method, args...]
+func (m *jsonMessage) subscriptionArgs() (string, json.RawMessage, error) {
+	var params []json.RawMessage
+	if err := json.Unmarshal(m.Params, &params); err != nil || len(params) == 0 {
+		return "", nil, _errInvalidParams
+	}
+
+	var name string
+	if err := json.Unmarshal(params[0], &name); err != nil || name == "" {
+		return "", nil, _errInvalidParams
+	}
+
+	rest, err := json.Marshal(params[1:])
+	if err != nil {
+		return "", nil, _errInvalidParams
+	}
+
+	return name, rest, nil
+}
+
 type jsonError struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
@@ -188,7 +292,9 @@ type jsonCodec struct {
 	closeC    chan struct{}
 	encode    func(x interface{}) error
 	decode    func(x interface{}) error
+	out       *countingWriter
 	conn      CloserAndDeadline
+	ntf       *Notifier
 }
 
 func (j *jsonCodec) readBatch() ([]*jsonMessage, bool, error) {
@@ -238,7 +344,8 @@ func (j *jsonCodec) readBatch() ([]*jsonMessage, bool, error) {
 	return msgs, isBatch, nil
 }
 
-func (j *jsonCodec) writeTo(ctx context.Context, x interface{}) error {
+// writeTo returns number of bytes written of the encoded x
+func (j *jsonCodec) writeTo(ctx context.Context, x interface{}) (int, error) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
@@ -248,29 +355,66 @@ func (j *jsonCodec) writeTo(ctx context.Context, x interface{}) error {
 	}
 
 	j.conn.SetWriteDeadline(deadline)
-	return j.encode(x)
+	start := j.out.n
+	err := j.encode(x)
+	return j.out.n - start, err
+}
+
+// setStatus is forwarded to the connection of HTTP
+func (j *jsonCodec) setStatus(code int) {
+	if s, ok := j.conn.(statusSetter); ok {
+		s.setStatus(code)
+	}
+}
+
+func (j *jsonCodec) notifier() *Notifier {
+	return j.ntf
+}
+
+func (j *jsonCodec) enableNotifier() {
+	j.ntf = newNotifier(j)
 }
 
 func (j *jsonCodec) close() {
 	j.closeOnce.Do(func() {
 		close(j.closeC)
+		if j.ntf != nil {
+			j.ntf.close()
+		}
+
 		j.conn.Close()
 	})
 }
 
 func newCodec(conn Conn) *jsonCodec {
-	enc := json.NewEncoder(conn)
-	dec := json.NewDecoder(conn)
-	dec.UseNumber()
+	return newFormatCodec(conn, _jsonFormat)
+}
 
+// newFormatCodec returns codec of conn, messages are encoded in format
+// f on the wire.
+func newFormatCodec(conn Conn, f *wireFormat) *jsonCodec {
+	out := &countingWriter{w: conn}
 	return &jsonCodec{
 		closeC: make(chan struct{}),
-		encode: enc.Encode,
-		decode: dec.Decode,
+		encode: f.newEncoder(out),
+		decode: f.newDecoder(conn),
+		out:    out,
 		conn:   conn,
 	}
 }
 
+// countingWriter counts bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
 type codecSet struct {
 	mu  sync.Mutex
 	scs map[serviceCodec]struct{}
@@ -304,6 +448,11 @@ func (c *codecSet) remove(sc serviceCodec) {
 	if c.contains(sc) {
 		delete(c.scs, sc)
 	}
+
+	// subscriptions are gone with the connection
+	if ntf := sc.notifier(); ntf != nil {
+		ntf.close()
+	}
 }
 
 func (c *codecSet) contains(sc serviceCodec) bool {
@@ -325,6 +474,6 @@ func (c *codecSet) each(cb func(serviceCodec) bool) {
 func (c *codecSet) close() {
 	c.each(func(sc serviceCodec) bool {
 		sc.close()
-		return true
+		return false
 	})
 }
@@ -0,0 +1,174 @@
+package anserpc
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chao77977/anserpc/util"
+)
+
+type corsOpt struct {
+	origins util.StringSet
+	headers []string
+	maxAge  time.Duration
+}
+
+// allowed reports whether requests of origin are allowed, "*" allows
+// all origins.
+func (c *corsOpt) allowed(origin string) bool {
+	return c.origins.Contains("*") || c.listed(origin)
+}
+
+// listed reports whether origin is given explicitly, only requests of
+// such origins are allowed with credentials, e.g. cookies.
+func (c *corsOpt) listed(origin string) bool {
+	return c.origins.Contains(strings.ToLower(origin))
+}
+
+// WithHTTPCorsOpt allows browsers of origins to call on HTTP and
+// Websocket, e.g. "https://example.com", or "*" for all origins. Only
+// the given origins are allowed with credentials, "*" allows the others
+// without. Headers are allowed in requests besides Content-Type, and
+// preflight responses are cached by browsers for maxAge.
+func WithHTTPCorsOpt(origins []string, headers []string, maxAge time.Duration) Option {
+	opt := &corsOpt{
+		origins: util.NewStringSet(),
+		maxAge:  maxAge,
+	}
+
+	for _, origin := range origins {
+		if origin = strings.TrimSuffix(origin, "/"); origin != "" {
+			opt.origins.Add(strings.ToLower(origin))
+		}
+	}
+
+	seen := util.WithLowerStringSet([]string{"content-type"})
+	opt.headers = []string{"Content-Type"}
+	for _, header := range headers {
+		if header == "" || seen.Contains(strings.ToLower(header)) {
+			continue
+		}
+
+		seen.Add(strings.ToLower(header))
+		opt.headers = append(opt.headers, http.CanonicalHeaderKey(header))
+	}
+
+	return &httpOpt{
+		cors: opt,
+	}
+}
+
+// allowedMethods returns methods of HTTP which are not denied
+func allowedMethods(denied util.StringSet) []string {
+	var methods []string
+	for _, method := range _httpMethods.List() {
+		if !denied.Contains(method) {
+			methods = append(methods, method)
+		}
+	}
+
+	sort.Strings(methods)
+	return append(methods, http.MethodOptions)
+}
+
+// corsHandler answers preflight requests of allowed origins, and sets
+// headers of CORS on their responses.
+type corsHandler struct {
+	cors    *corsOpt
+	methods []string
+	next    http.Handler
+}
+
+func (c *corsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.cors == nil {
+		c.next.ServeHTTP(w, r)
+		return
+	}
+
+	// responses are different by origin, even if it is absent
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		c.next.ServeHTTP(w, r)
+		return
+	}
+
+	preflight := r.Method == http.MethodOptions &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+	if !c.cors.allowed(origin) {
+		if preflight {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		c.next.ServeHTTP(w, r)
+		return
+	}
+
+	if c.cors.listed(origin) {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+	} else {
+		h.Set("Access-Control-Allow-Origin", "*")
+	}
+
+	if !preflight {
+		h.Set("Access-Control-Expose-Headers", _requestIDHeader)
+		c.next.ServeHTTP(w, r)
+		return
+	}
+
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	h.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+	h.Set("Access-Control-Allow-Headers", strings.Join(c.cors.headers, ", "))
+	if c.cors.maxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.cors.maxAge/time.Second)))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newCorsHandler(opt *httpOpt, next http.Handler) http.Handler {
+	return &corsHandler{
+		cors:    opt.cors,
+		methods: allowedMethods(opt.deniedMethods),
+		next:    next,
+	}
+}
+
+// checkOrigin allows Websocket upgrade requests of the same host, and
+// origins of CORS. Origins allowed by "*" are not allowed with
+// credentials, as browsers send them on upgrade regardless of CORS.
+func checkOrigin(opt *httpOpt) func(r *http.Request) bool {
+	if opt.cors == nil {
+		// the default of upgrader, the same host only
+		return nil
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || opt.cors.listed(origin) {
+			return true
+		}
+
+		u := strings.SplitN(origin, "://", 2)
+		if len(u) == 2 && strings.EqualFold(u[1], r.Host) {
+			return true
+		}
+
+		return opt.cors.allowed(origin) && !hasCredentials(r)
+	}
+}
+
+// hasCredentials reports whether r carries credentials which are sent
+// by browsers, i.e. cookies, HTTP authentication and client certificate.
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != "" ||
+		(r.TLS != nil && len(r.TLS.PeerCertificates) != 0)
+}
@@ -0,0 +1,228 @@
+package anserpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newCorsServer(origins ...string) *httptest.Server {
+	return newCorsServerWithOpts(origins)
+}
+
+func newCorsServerWithOpts(origins []string, extra ...Option) *httptest.Server {
+	opts := defaultOpt()
+	WithHTTPCorsOpt(origins, []string{"authorization", "X-API-Key"}, 10*time.Minute).apply(opts)
+	for _, opt := range extra {
+		opt.apply(opts)
+	}
+
+	return httptest.NewServer(newHttpServer(opts.http, newTestRegistry(&requestIDEcho{}), nil).head)
+}
+
+func TestCorsPreflight(t *testing.T) {
+	ts := newCorsServer("https://app.example.com/")
+	defer ts.Close()
+
+	preflight := func(origin, method string) *http.Response {
+		req, _ := http.NewRequest(http.MethodOptions, ts.URL, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		return resp
+	}
+
+	resp := preflight("https://APP.example.com", http.MethodPost)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", resp.StatusCode)
+	}
+
+	for k, v := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://APP.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, HEAD, PATCH, POST, OPTIONS",
+		"Access-Control-Allow-Headers":     "Content-Type, Authorization, X-Api-Key",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := resp.Header.Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+
+	if resp := preflight("https://evil.example.com", http.MethodPost); resp.StatusCode != http.StatusForbidden ||
+		resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight of other origin = %d %v, want 403", resp.StatusCode, resp.Header)
+	}
+
+	// OPTIONS without CORS is not handled as a call
+	req, _ := http.NewRequest(http.MethodOptions, ts.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Allow") == "" {
+		t.Errorf("OPTIONS = %d %v, want 204 with allowed methods", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestCorsActualRequest(t *testing.T) {
+	ts := newCorsServer("https://app.example.com")
+	defer ts.Close()
+
+	post := func(origin string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(
+			`{"jsonrpc":"2.0","id":1,"service":"test","method":"id"}`))
+		req.Header.Set("Content-Type", _defAppJson)
+		req.Header.Set("Origin", origin)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		return resp
+	}
+
+	resp := post("https://app.example.com")
+	if resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		resp.Header.Get("Access-Control-Allow-Credentials") != "true" ||
+		resp.Header.Get("Access-Control-Expose-Headers") != _requestIDHeader {
+		t.Errorf("response = %d %v, want headers of CORS", resp.StatusCode, resp.Header)
+	}
+
+	// the browser blocks responses without headers of CORS
+	if resp := post("https://evil.example.com"); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("response of other origin = %v, want no headers of CORS", resp.Header)
+	}
+}
+
+func TestCorsWebsocketOrigin(t *testing.T) {
+	ts := newCorsServer("https://app.example.com")
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	for origin, ok := range map[string]bool{
+		"https://app.example.com":  true,
+		"https://evil.example.com": false,
+		ts.URL:                     true,
+		"":                         true,
+	} {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+
+		conn, _, err := websocket.DefaultDialer.Dial(url, header)
+		if conn != nil {
+			conn.Close()
+		}
+
+		if (err == nil) != ok {
+			t.Errorf("dial with origin %q: %v, want allowed %v", origin, err, ok)
+		}
+	}
+}
+
+func TestCorsWildcard(t *testing.T) {
+	ts := newCorsServer("*", "https://app.example.com")
+	defer ts.Close()
+
+	post := func(origin string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(
+			`{"jsonrpc":"2.0","id":1,"service":"test","method":"id"}`))
+		req.Header.Set("Content-Type", _defAppJson)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		return resp
+	}
+
+	// origins of "*" are allowed without credentials
+	resp := post("https://evil.example.com")
+	if resp.Header.Get("Access-Control-Allow-Origin") != "*" ||
+		resp.Header.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("response of other origin = %v, want any origin without credentials", resp.Header)
+	}
+
+	resp = post("https://app.example.com")
+	if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("response of given origin = %v, want origin with credentials", resp.Header)
+	}
+
+	// caches do not share responses of different origins
+	if resp := post(""); resp.Header.Get("Vary") != "Origin" {
+		t.Errorf("response without origin = %v, want Vary of Origin", resp.Header)
+	}
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	for _, c := range []struct {
+		origin string
+		cookie string
+		ok     bool
+	}{
+		{"https://evil.example.com", "", true},
+		{"https://evil.example.com", "session=1", false},
+		{"https://app.example.com", "session=1", true},
+	} {
+		header := http.Header{}
+		header.Set("Origin", c.origin)
+		if c.cookie != "" {
+			header.Set("Cookie", c.cookie)
+		}
+
+		conn, _, err := websocket.DefaultDialer.Dial(url, header)
+		if conn != nil {
+			conn.Close()
+		}
+
+		if (err == nil) != c.ok {
+			t.Errorf("dial with origin %q and cookie %q: %v, want allowed %v",
+				c.origin, c.cookie, err, c.ok)
+		}
+	}
+}
+
+func TestCorsVirtualHost(t *testing.T) {
+	ts := newCorsServerWithOpts([]string{"https://app.example.com"},
+		WithHTTPVhostOpt("app.example.com"))
+	defer ts.Close()
+
+	// preflight of a denied host is not answered
+	req, _ := http.NewRequest(http.MethodOptions, ts.URL, nil)
+	req.Host = "evil.example.com"
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight of denied host = %d %v, want 403", resp.StatusCode, resp.Header)
+	}
+}
@@ -0,0 +1,269 @@
+package anserpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	_openRPCVersion = "1.2.6"
+	_discoverMethod = "rpc.discover"
+)
+
+var (
+	_timeType       = reflect.TypeOf(time.Time{})
+	_rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// OpenRPC is the document returned by built-in method rpc.discover, see
+// https://spec.open-rpc.org
+type OpenRPC struct {
+	OpenRPC string           `json:"openrpc"`
+	Info    OpenRPCInfo      `json:"info"`
+	Methods []*OpenRPCMethod `json:"methods"`
+}
+
+type OpenRPCInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenRPCMethod is named as "group/service_version.method", the same as
+// keys of Policy, and the request is addressed by the x- fields.
+type OpenRPCMethod struct {
+	Name           string               `json:"name"`
+	ParamStructure string               `json:"paramStructure"`
+	Params         []*OpenRPCDescriptor `json:"params"`
+	Result         *OpenRPCDescriptor   `json:"result"`
+	Group          string               `json:"x-group,omitempty"`
+	Service        string               `json:"x-service"`
+	Version        string               `json:"x-service-version,omitempty"`
+	Method         string               `json:"x-method"`
+	Context        bool                 `json:"x-context"`
+	Subscription   bool                 `json:"x-subscription,omitempty"`
+	Public         bool                 `json:"x-public"`
+}
+
+type OpenRPCDescriptor struct {
+	Name     string                 `json:"name"`
+	Required bool                   `json:"required,omitempty"`
+	Schema   map[string]interface{} `json:"schema"`
+}
+
+// discover returns methods available to the principal of ctx
+func (s *serviceRegistry) discover(ctx context.Context) *OpenRPC {
+	type entry struct {
+		grp string
+		srv *service
+	}
+
+	s.mu.Lock()
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	var entries []entry
+	for _, name := range names {
+		for _, srv := range s.groups[name].services {
+			entries = append(entries, entry{grp: name, srv: srv})
+		}
+	}
+	s.mu.Unlock()
+
+	doc := &OpenRPC{
+		OpenRPC: _openRPCVersion,
+		Info:    OpenRPCInfo{Title: "anserpc", Version: "1.0"},
+		Methods: make([]*OpenRPCMethod, 0),
+	}
+
+	for _, e := range entries {
+		methods := e.srv.methods()
+		sort.Strings(methods)
+		for _, method := range methods {
+			if s.authorize(ctx, e.grp, e.srv, method) != nil {
+				continue
+			}
+
+			doc.Methods = append(doc.Methods,
+				describeMethod(e.grp, e.srv, method, e.srv.callbacks[method]))
+		}
+	}
+
+	return doc
+}
+
+func describeMethod(grp string, srv *service, method string, cb *callback) *OpenRPCMethod {
+	name := string(srv.fingerprint()) + "." + method
+	if grp != "" {
+		name = grp + "/" + name
+	}
+
+	m := &OpenRPCMethod{
+		Name:           name,
+		ParamStructure: "by-position",
+		Params:         make([]*OpenRPCDescriptor, 0, len(cb.argTypes)),
+		Group:          grp,
+		Service:        srv.name,
+		Version:        srv.version,
+		Method:         method,
+		Context:        cb.hasCtx,
+		Subscription:   cb.isSubscribe,
+		Public:         srv.public,
+	}
+
+	if len(cb.paramNames) != 0 {
+		m.ParamStructure = "either"
+	}
+
+	for i, argType := range cb.argTypes {
+		param := &OpenRPCDescriptor{
+			Name:     "arg" + strconv.Itoa(i),
+			Required: argType.Kind() != reflect.Ptr,
+			Schema:   jsonSchema(argType, nil),
+		}
+
+		if i < len(cb.paramNames) {
+			param.Name = cb.paramNames[i]
+		}
+
+		m.Params = append(m.Params, param)
+	}
+
+	m.Result = &OpenRPCDescriptor{
+		Name:   "result",
+		Schema: map[string]interface{}{"type": "null"},
+	}
+
+	if cb.isSubscribe {
+		// the subscription id is responded
+		m.Result.Schema = map[string]interface{}{"type": "string"}
+	} else if cb.returnType == 1 {
+		m.Result.Schema = jsonSchema(cb.fn.Type().Out(0), nil)
+	}
+
+	return m
+}
+
+// jsonSchema describes how t is encoded by encoding/json, seen is used
+// to stop at recursive types.
+func jsonSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case _timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case _rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": jsonSchema(t.Elem(), seen),
+		}
+	case reflect.Struct:
+		return structSchema(t, seen)
+	}
+
+	// interface, any value
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object"}
+	if seen[t] {
+		return schema
+	}
+
+	if seen == nil {
+		seen = make(map[reflect.Type]bool)
+	}
+
+	seen[t] = true
+	defer delete(seen, t)
+
+	props := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		name, opts := f.Name, ""
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+
+			if i := strings.Index(tag, ","); i >= 0 {
+				tag, opts = tag[:i], tag[i:]
+			}
+
+			if tag != "" {
+				name = tag
+			}
+		}
+
+		// fields of embedded struct are promoted
+		if f.Anonymous && name == f.Name {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				embedded := structSchema(ft, seen)
+				if p, ok := embedded["properties"].(map[string]interface{}); ok {
+					for k, v := range p {
+						props[k] = v
+					}
+				}
+
+				continue
+			}
+
+			if f.PkgPath != "" {
+				continue
+			}
+		}
+
+		props[name] = jsonSchema(f.Type, seen)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+
+	schema["properties"] = props
+	if len(required) != 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+
+	return schema
+}
@@ -0,0 +1,147 @@
+package anserpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type node struct {
+	Name     string    `json:"name"`
+	Parent   *node     `json:"parent,omitempty"`
+	Children []*node   `json:"children"`
+	Created  time.Time `json:"created"`
+	Tags     map[string]string
+	Data     []byte `json:"-"`
+	hidden   int
+}
+
+func discoverDoc(t *testing.T, sr *serviceRegistry, p *Principal) *OpenRPC {
+	t.Helper()
+
+	resp := serveAs(t, sr, p, `{"jsonrpc":"2.0","id":1,"method":"rpc.discover"}`)
+	if resp.hasErr() {
+		t.Fatalf("discover error: %+v", resp.Error)
+	}
+
+	var doc OpenRPC
+	if err := json.Unmarshal(resp.Result, &doc); err != nil {
+		t.Fatalf("invalid document %s: %v", resp.Result, err)
+	}
+
+	return &doc
+}
+
+func findMethod(doc *OpenRPC, name string) *OpenRPCMethod {
+	for _, m := range doc.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func TestDiscover(t *testing.T) {
+	sr := newGeometryRegistry(t)
+	doc := discoverDoc(t, sr, nil)
+
+	if doc.OpenRPC != _openRPCVersion {
+		t.Errorf("openrpc = %s, want %s", doc.OpenRPC, _openRPCVersion)
+	}
+
+	discover := findMethod(doc, "built-in_1.0.rpc.discover")
+	if discover == nil || !discover.Context || len(discover.Params) != 0 {
+		t.Errorf("discover = %+v, want method with ctx and no params", discover)
+	}
+
+	scale := findMethod(doc, "geometry.scale")
+	if scale == nil {
+		t.Fatalf("method geometry.scale not found in %+v", doc.Methods)
+	}
+
+	if scale.ParamStructure != "either" || scale.Context || len(scale.Params) != 3 {
+		t.Fatalf("scale = %+v, want 3 named params", scale)
+	}
+
+	p := scale.Params[0]
+	if p.Name != "p" || p.Required || p.Schema["type"] != "object" {
+		t.Errorf("param p = %+v, want optional object", p)
+	}
+
+	if props, _ := p.Schema["properties"].(map[string]interface{}); len(props) != 2 {
+		t.Errorf("properties of p = %v, want x and y", p.Schema["properties"])
+	}
+
+	if n := scale.Params[1]; n.Name != "n" || !n.Required || n.Schema["type"] != "integer" {
+		t.Errorf("param n = %+v, want required integer", n)
+	}
+
+	if scale.Result.Schema["type"] != "integer" {
+		t.Errorf("result = %+v, want integer", scale.Result)
+	}
+
+	move := findMethod(doc, "geometry.move")
+	if move == nil || move.ParamStructure != "by-position" ||
+		move.Params[0].Name != "arg0" {
+		t.Errorf("move = %+v, want positional param arg0", move)
+	}
+}
+
+func TestDiscoverName(t *testing.T) {
+	sr := newGeometryRegistry(t)
+
+	// it is only registered as rpc.discover of built-in service
+	for req, ok := range map[string]bool{
+		`{"jsonrpc":"2.0","id":1,"service":"built-in","method":"rpc.discover"}`: true,
+		`{"jsonrpc":"2.0","id":1,"service":"built-in","method":"discover"}`:     false,
+		`{"jsonrpc":"2.0","id":1,"service":"geometry","method":"rpc.discover"}`: false,
+	} {
+		if resp := serveAs(t, sr, nil, req); resp.hasErr() == ok {
+			t.Errorf("response of %s = %+v, want ok %v", req, resp, ok)
+		}
+	}
+}
+
+func TestDiscoverPolicy(t *testing.T) {
+	sr := newPolicyRegistry(&Policy{
+		Methods: map[string][]string{"system/ops_1.0.restart": {"admin"}},
+	})
+
+	doc := discoverDoc(t, sr, &Principal{Name: "op"})
+	if findMethod(doc, "system/ops_1.0.restart") != nil {
+		t.Error("denied method is discovered")
+	}
+
+	// not public and not matched by policy
+	if findMethod(doc, "system/ops_1.0.status") != nil {
+		t.Error("method of private service is discovered")
+	}
+
+	if findMethod(doc, "profile_1.0.name") == nil {
+		t.Error("method of public service is not discovered")
+	}
+
+	doc = discoverDoc(t, sr, &Principal{Name: "root", Roles: []string{"admin"}})
+	if m := findMethod(doc, "system/ops_1.0.restart"); m == nil || m.Public ||
+		m.Group != "system" || m.Service != "ops" || m.Version != "1.0" {
+		t.Errorf("restart = %+v, want private method of system/ops_1.0", m)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema := jsonSchema(reflect.TypeOf(&node{}), nil)
+	data, _ := json.Marshal(schema)
+
+	want := `{"properties":{` +
+		`"Tags":{"additionalProperties":{"type":"string"},"type":"object"},` +
+		`"children":{"items":{"type":"object"},"type":"array"},` +
+		`"created":{"format":"date-time","type":"string"},` +
+		`"name":{"type":"string"},` +
+		`"parent":{"type":"object"}},` +
+		`"required":["Tags","children","created","name"],"type":"object"}`
+	if string(data) != want {
+		t.Errorf("schema = %s, want %s", data, want)
+	}
+}
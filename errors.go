@@ -1,84 +1,151 @@
 package anserpc
 
+// Codes of errors responded by anserpc
 const (
-	_defErrCode = -32000
+	CodeDefault                  = -32000
+	CodeInvalidRequest           = -32600
+	CodeMethodNotFound           = -32601
+	CodeInvalidParams            = -32602
+	CodeInternal                 = -32603
+	CodeParse                    = -32700
+	CodeProtoVersion             = -32001
+	CodeServiceOrMethodNotFound  = -32002
+	CodeServiceNotFound          = -32003
+	CodeResultErrorNotFound      = -32004
+	CodeTooManyResults           = -32005
+	CodeMethodCrashed            = -32006
+	CodeTooManyParams            = -32007
+	CodeMissingValueParams       = -32008
+	CodeHandleTimeout            = -32009
+	CodeNotificationsUnsupported = -32010
+	CodeSubscriptionNotFound     = -32011
+	CodeUnauthenticated          = -32013
+	CodePermissionDenied         = -32014
+	CodeVersionNotFound          = -32015
+	CodeRequestCanceled          = -32016
+	CodeRateLimited              = -32017
+	CodeShuttingDown             = -32018
+)
+
+const (
+	_defErrCode = CodeDefault
 )
 
 var (
 	// the JSON sent is not a valid Request object
 	_errInvalidRequest = StatusError{
-		code: -32600,
+		code: CodeInvalidRequest,
 		err:  "invalid request",
 	}
 
 	// the method does not exist / is not available
 	_errMethodNotFound = StatusError{
-		code: -32601,
+		code: CodeMethodNotFound,
 		err:  "method not found",
 	}
 
 	// invalid method parameter(s)
 	_errInvalidParams = StatusError{
-		code: -32602,
+		code: CodeInvalidParams,
 		err:  "invalid params",
 	}
 
 	// internal JSON-RPC error
 	_errInternal = StatusError{
-		code: -32603,
+		code: CodeInternal,
 		err:  "internal error",
 	}
 
 	// invalid JSON was received by the server
 	_errJSONContent = StatusError{
-		code: -32700,
+		code: CodeParse,
 		err:  "parse error",
 	}
 
 	_errProtoVersion = StatusError{
-		code: -32001,
+		code: CodeProtoVersion,
 		err:  "invalid version",
 	}
 
 	_errProtoServiceOrMethodNotFound = StatusError{
-		code: -32002,
+		code: CodeServiceOrMethodNotFound,
 		err:  "service or method not found",
 	}
 
 	_errServiceNotFound = StatusError{
-		code: -32003,
+		code: CodeServiceNotFound,
 		err:  "service not found",
 	}
 
 	_errResultErrorNotFound = StatusError{
-		code: -32004,
+		code: CodeResultErrorNotFound,
 		err:  "error of return result not found",
 	}
 
 	_errNumOfResult = StatusError{
-		code: -32005,
+		code: CodeTooManyResults,
 		err:  "too many return results",
 	}
 
 	_errMethodCrashed = StatusError{
-		code: -32006,
+		code: CodeMethodCrashed,
 		err:  "method running crash",
 	}
 
 	_errTooManyParams = StatusError{
-		code: -32007,
+		code: CodeTooManyParams,
 		err:  "too many params",
 	}
 
 	_errMissingValueParams = StatusError{
-		code: -32008,
+		code: CodeMissingValueParams,
 		err:  "missing value for params",
 	}
 
 	_errHandleTimeout = StatusError{
-		code: -32009,
+		code: CodeHandleTimeout,
 		err:  "handling message timeout",
 	}
+
+	_errNotificationsUnsupported = StatusError{
+		code: CodeNotificationsUnsupported,
+		err:  "notifications not supported",
+	}
+
+	_errSubscriptionNotFound = StatusError{
+		code: CodeSubscriptionNotFound,
+		err:  "subscription not found",
+	}
+
+	_errUnauthenticated = StatusError{
+		code: CodeUnauthenticated,
+		err:  "unauthenticated",
+	}
+
+	_errPermissionDenied = StatusError{
+		code: CodePermissionDenied,
+		err:  "permission denied",
+	}
+
+	_errVersionNotFound = StatusError{
+		code: CodeVersionNotFound,
+		err:  "version not found",
+	}
+
+	_errRequestCanceled = StatusError{
+		code: CodeRequestCanceled,
+		err:  "request canceled",
+	}
+
+	_errRateLimited = StatusError{
+		code: CodeRateLimited,
+		err:  "rate limited",
+	}
+
+	_errShuttingDown = StatusError{
+		code: CodeShuttingDown,
+		err:  "server is shutting down",
+	}
 )
 
 type StatusError struct {
@@ -97,3 +164,20 @@ func (s StatusError) ErrorMessage() string {
 func (s StatusError) Error() string {
 	return s.ErrorMessage()
 }
+
+// withData returns the error with data, e.g. available versions
+func (s StatusError) withData(data interface{}) error {
+	return &statusDataError{
+		StatusError: s,
+		data:        data,
+	}
+}
+
+type statusDataError struct {
+	StatusError
+	data interface{}
+}
+
+func (s *statusDataError) ErrorData() interface{} {
+	return s.data
+}
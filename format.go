@@ -0,0 +1,209 @@
+package anserpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	_defAppMsgpack  = "application/msgpack"
+	_defAppXMsgpack = "application/x-msgpack"
+	_defAppCBOR     = "application/cbor"
+)
+
+// Format is the encoding of messages on the wire. Messages of MessagePack
+// and CBOR are converted to JSON, so params are decoded into args of
+// method, and results are encoded, by encoding/json in every format.
+type Format string
+
+const (
+	FormatJSON    Format = "json"
+	FormatMsgpack Format = "msgpack"
+	FormatCBOR    Format = "cbor"
+)
+
+type wireFormat struct {
+	name        Format
+	contentType string
+	// messages are sent in binary frames of Websocket
+	binary     bool
+	newEncoder func(w io.Writer) func(x interface{}) error
+	newDecoder func(r io.Reader) func(x interface{}) error
+}
+
+var (
+	_jsonFormat = &wireFormat{
+		name:        FormatJSON,
+		contentType: _defAppJson,
+		newEncoder: func(w io.Writer) func(x interface{}) error {
+			return json.NewEncoder(w).Encode
+		},
+		newDecoder: func(r io.Reader) func(x interface{}) error {
+			dec := json.NewDecoder(r)
+			dec.UseNumber()
+			return dec.Decode
+		},
+	}
+
+	_msgpackFormat = &wireFormat{
+		name:        FormatMsgpack,
+		contentType: _defAppMsgpack,
+		binary:      true,
+		newEncoder: func(w io.Writer) func(x interface{}) error {
+			enc := msgpack.NewEncoder(w)
+			enc.SetSortMapKeys(true)
+			return transcodeEncoder(enc.Encode)
+		},
+		newDecoder: func(r io.Reader) func(x interface{}) error {
+			return transcodeDecoder(msgpack.NewDecoder(r).Decode)
+		},
+	}
+
+	_cborEncMode, _ = cbor.EncOptions{Sort: cbor.SortCanonical}.EncMode()
+
+	_cborFormat = &wireFormat{
+		name:        FormatCBOR,
+		contentType: _defAppCBOR,
+		binary:      true,
+		newEncoder: func(w io.Writer) func(x interface{}) error {
+			return transcodeEncoder(_cborEncMode.NewEncoder(w).Encode)
+		},
+		newDecoder: func(r io.Reader) func(x interface{}) error {
+			return transcodeDecoder(cbor.NewDecoder(r).Decode)
+		},
+	}
+
+	_wireFormats = []*wireFormat{_jsonFormat, _msgpackFormat, _cborFormat}
+)
+
+// formatOf returns format of name, nil if it is unknown
+func formatOf(name Format) *wireFormat {
+	for _, f := range _wireFormats {
+		if f.name == Format(strings.ToLower(string(name))) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// formatOfContentType returns format of media type of HTTP, JSON is used
+// for the others.
+func formatOfContentType(mediaType string) *wireFormat {
+	switch strings.ToLower(mediaType) {
+	case _defAppMsgpack, _defAppXMsgpack:
+		return _msgpackFormat
+	case _defAppCBOR:
+		return _cborFormat
+	}
+
+	return _jsonFormat
+}
+
+// isParseError reports whether err is caused by invalid content, but not
+// the connection.
+func isParseError(err error) bool {
+	if _, ok := err.(*json.SyntaxError); ok {
+		return true
+	}
+
+	return err == _errJSONContent
+}
+
+// transcodeEncoder converts x to the generic value of JSON, and encodes
+// it by encode.
+func transcodeEncoder(encode func(v interface{}) error) func(x interface{}) error {
+	return func(x interface{}) error {
+		b, err := json.Marshal(x)
+		if err != nil {
+			return err
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+
+		return encode(fromJSONValue(v))
+	}
+}
+
+// transcodeDecoder decodes a generic value by decode, and converts it to
+// JSON of x, e.g. *json.RawMessage.
+func transcodeDecoder(decode func(v interface{}) error) func(x interface{}) error {
+	return func(x interface{}) error {
+		var v interface{}
+		if err := decode(&v); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return err
+			}
+
+			return _errJSONContent
+		}
+
+		b, err := json.Marshal(toJSONValue(v))
+		if err != nil {
+			return _errJSONContent
+		}
+
+		return json.Unmarshal(b, x)
+	}
+}
+
+// fromJSONValue converts numbers to integers if they can be
+func fromJSONValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := t.Float64()
+		return f
+	case []interface{}:
+		for i := range t {
+			t[i] = fromJSONValue(t[i])
+		}
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = fromJSONValue(t[k])
+		}
+	}
+
+	return v
+}
+
+// toJSONValue converts maps of any keys to objects, and tags of CBOR to
+// their contents.
+func toJSONValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		for i := range t {
+			t[i] = toJSONValue(t[i])
+		}
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = toJSONValue(t[k])
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = toJSONValue(e)
+		}
+
+		return m
+	case cbor.Tag:
+		return toJSONValue(t.Content)
+	}
+
+	return v
+}
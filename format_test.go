@@ -0,0 +1,177 @@
+package anserpc
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type vec struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type plane struct{}
+
+func (g *plane) Move(p vec, dx int) (vec, error) {
+	return vec{X: p.X + dx, Y: p.Y}, nil
+}
+
+func (g *plane) Size(b []byte) (int, error) { return len(b), nil }
+
+func newPlaneRegistry() *serviceRegistry {
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{
+		Service:    "plane",
+		Public:     true,
+		Receiver:   &plane{},
+		ParamNames: map[string][]string{"Move": {"p", "dx"}},
+	})
+
+	return sr
+}
+
+type wireResponse struct {
+	ID     int                    `msgpack:"id" cbor:"id"`
+	Result interface{}            `msgpack:"result" cbor:"result"`
+	Error  map[string]interface{} `msgpack:"error" cbor:"error"`
+}
+
+func TestFormatHTTP(t *testing.T) {
+	ts := httptest.NewServer(newHttpServer(withDefaultHTTPOpt(), newPlaneRegistry(), nil).head)
+	defer ts.Close()
+
+	for _, c := range []struct {
+		contentType string
+		marshal     func(v interface{}) ([]byte, error)
+		unmarshal   func(b []byte, v interface{}) error
+	}{
+		{_defAppMsgpack, msgpack.Marshal, msgpack.Unmarshal},
+		{_defAppCBOR, cbor.Marshal, cbor.Unmarshal},
+	} {
+		for _, p := range []struct {
+			req  map[string]interface{}
+			want interface{}
+		}{
+			// positional and named params are decoded into args
+			{map[string]interface{}{"jsonrpc": "2.0", "id": 1, "service": "plane",
+				"method": "move", "params": []interface{}{map[string]interface{}{"x": 1, "y": 2}, 3}},
+				map[string]interface{}{"x": 4, "y": 2}},
+			{map[string]interface{}{"jsonrpc": "2.0", "id": 2, "service": "plane",
+				"method": "move", "params": map[string]interface{}{"p": map[string]interface{}{"x": 1}, "dx": -1}},
+				map[string]interface{}{"x": 0, "y": 0}},
+			// binary of the format is decoded into []byte
+			{map[string]interface{}{"jsonrpc": "2.0", "id": 3, "service": "plane",
+				"method": "size", "params": []interface{}{[]byte{1, 2, 3}}}, 3},
+		} {
+			b, err := c.marshal(p.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := http.Post(ts.URL, c.contentType, bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body bytes.Buffer
+			body.ReadFrom(resp.Body)
+			resp.Body.Close()
+
+			if ct := resp.Header.Get("content-type"); ct != c.contentType {
+				t.Errorf("content type = %s, want %s", ct, c.contentType)
+			}
+
+			var out wireResponse
+			if err := c.unmarshal(body.Bytes(), &out); err != nil {
+				t.Fatalf("invalid %s response %x: %v", c.contentType, body.Bytes(), err)
+			}
+
+			if out.Error != nil || !sameValue(out.Result, p.want) {
+				t.Errorf("%s response of %v = %+v, want %v", c.contentType,
+					p.req["id"], out, p.want)
+			}
+		}
+	}
+}
+
+// sameValue compares decoded values regardless of types of integers
+func sameValue(a, b interface{}) bool {
+	return strings.Replace(Fmt("%v", a), "map[interface {}]interface {}", "map", -1) ==
+		strings.Replace(Fmt("%v", b), "map[string]interface {}", "map", -1)
+}
+
+func TestFormatWebsocket(t *testing.T) {
+	server := newHttpServer(withDefaultHTTPOpt(), newPlaneRegistry(), nil)
+	ts := httptest.NewServer(server.head)
+	defer ts.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"msgpack"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != "msgpack" {
+		t.Fatalf("subprotocol = %q, want msgpack", conn.Subprotocol())
+	}
+
+	b, _ := msgpack.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1,
+		"service": "plane", "method": "size", "params": []interface{}{[]byte("abcd")}})
+	conn.WriteMessage(websocket.BinaryMessage, b)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msgType, data, err := conn.ReadMessage()
+	if err != nil || msgType != websocket.BinaryMessage {
+		t.Fatalf("read message type %d: %v, want binary", msgType, err)
+	}
+
+	var out wireResponse
+	if err := msgpack.Unmarshal(data, &out); err != nil || !sameValue(out.Result, 4) {
+		t.Errorf("response = %+v (%v), want 4", out, err)
+	}
+}
+
+func TestFormatIPC(t *testing.T) {
+	server := newIPCServer(newPlaneRegistry(), nil, formatOf(FormatCBOR), 0)
+	client, conn := net.Pipe()
+	defer client.Close()
+
+	go server.serveIPC(conn)
+
+	enc := cbor.NewEncoder(client)
+	dec := cbor.NewDecoder(client)
+	for i := 1; i <= 2; i++ {
+		if err := enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": i,
+			"service": "plane", "method": "move",
+			"params": []interface{}{map[string]interface{}{"x": i}, 1}}); err != nil {
+			t.Fatal(err)
+		}
+
+		var out wireResponse
+		if err := dec.Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]interface{}{"x": i + 1, "y": 0}
+		if out.ID != i || !sameValue(out.Result, want) {
+			t.Errorf("response = %+v, want %v", out, want)
+		}
+	}
+
+	// invalid content is responded with invalid request
+	client.Write([]byte{0xff, 0xff})
+	var out wireResponse
+	if err := dec.Decode(&out); err != nil || out.Error == nil {
+		t.Errorf("response = %+v (%v), want invalid request", out, err)
+	}
+}
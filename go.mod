@@ -3,8 +3,11 @@ module github.com/chao77977/anserpc
 go 1.15
 
 require (
+	github.com/fxamacker/cbor/v2 v2.2.0
 	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/gorilla/websocket v1.5.3
 	github.com/inconshreveable/log15 v0.0.0-20201112154412-8562bdadbbac
 	github.com/mattn/go-colorable v0.1.8 // indirect
 	github.com/rcrowley/go-metrics v0.0.0-20201227073835-cf1acfcdf475
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 )
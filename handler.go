@@ -2,37 +2,130 @@ package anserpc
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"reflect"
 	"runtime"
+	"sync"
 	"time"
+
+	"github.com/chao77977/anserpc/util"
 )
 
 const (
-	_defTimeout = 3600 // 2 hours
+	_defTimeout = time.Hour
 )
 
-func doHandle(ctx context.Context, jCodec serviceCodec, sr *serviceRegistry) {
+func doHandle(ctx context.Context, jCodec serviceCodec, sr *serviceRegistry) bool {
 	msgs, isBatch, err := jCodec.readBatch()
 	if err != nil {
 		_xlog.Debug("Read message error", "err", err)
 		jCodec.writeTo(ctx, makeJSONErrorMessage(_errInvalidRequest))
-		return
+		return true
+	}
+
+	return handleAndWrite(ctx, jCodec, sr, msgs, isBatch)
+}
+
+// handleAndWrite handles messages and writes responses back, it returns
+// false if nothing is written, e.g. all messages are notifications.
+func handleAndWrite(ctx context.Context, jCodec serviceCodec, sr *serviceRegistry,
+	msgs []*jsonMessage, isBatch bool) bool {
+	// an empty batch is an invalid request
+	if len(msgs) == 0 {
+		jCodec.writeTo(ctx, makeJSONErrorMessage(_errInvalidRequest))
+		return true
+	}
+
+	if ntf := jCodec.notifier(); ntf != nil {
+		ctx = context.WithValue(ctx, "anser-notifier", ntf)
+	}
+
+	// calls of batch are children of the batch span
+	if isBatch {
+		var sp *span
+		ctx, sp = sr.tracing().start(ctx, "handler.batch")
+		sp.setAttr("rpc.transport", transportFromContext(ctx))
+		sp.setAttr("rpc.batch_size", len(msgs))
+		defer sp.end(nil)
 	}
 
 	msgHdl := newHandler(sr, ctx)
 	defer msgHdl.close()
 
+	// calls are done once their responses are written
+	defer func() {
+		sr.calls.done(msgHdl.tracked)
+	}()
+
+	var resp interface{}
 	if !isBatch {
-		jCodec.writeTo(ctx, msgHdl.handleMsg(msgs[0]))
+		if retMsg := msgHdl.handleMsg(msgs[0]); retMsg != nil {
+			resp = retMsg
+		}
 	} else {
-		jCodec.writeTo(ctx, msgHdl.handleMsgs(msgs))
+		if retMsgs := msgHdl.handleMsgs(msgs); len(retMsgs) != 0 {
+			resp = retMsgs
+		}
+	}
+
+	if resp == nil {
+		msgHdl.logCalls(0)
+		msgHdl.activateSubscriptions(jCodec)
+		return false
+	}
+
+	if s, ok := jCodec.(statusSetter); ok && rateLimited(resp) {
+		s.setStatus(http.StatusTooManyRequests)
 	}
+
+	size, err := jCodec.writeTo(ctx, resp)
+	msgHdl.logCalls(size)
+	if err != nil {
+		msgHdl.cancelSubscriptions(jCodec)
+		return true
+	}
+
+	// notifications are sent after client knows subscription ids
+	msgHdl.activateSubscriptions(jCodec)
+	return true
+}
+
+// statusSetter sets status of HTTP response before it is written
+type statusSetter interface {
+	setStatus(code int)
+}
+
+// rateLimited reports whether all responses are rate limited
+func rateLimited(resp interface{}) bool {
+	var msgs []*jsonMessage
+	switch r := resp.(type) {
+	case *jsonMessage:
+		msgs = append(msgs, r)
+	case []*jsonMessage:
+		msgs = r
+	}
+
+	for _, msg := range msgs {
+		if !msg.hasErr() || msg.Error.Code != _errRateLimited.ErrorCode() {
+			return false
+		}
+	}
+
+	return len(msgs) != 0
 }
 
 type handler struct {
 	sr    *serviceRegistry
 	ctx   context.Context
 	msgsC []chan *jsonMessage
+	subMu sync.Mutex
+	subs  []*Subscription
+	// replied calls are logged once responses are written
+	logMu   sync.Mutex
+	replied []*call
+	// number of calls counted by sr.calls
+	tracked int
 }
 
 func newHandler(sr *serviceRegistry, ctx context.Context) *handler {
@@ -53,6 +146,46 @@ func (h *handler) close() {
 	}
 }
 
+func (h *handler) addSubscription(sub *Subscription) {
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+
+	h.subs = append(h.subs, sub)
+}
+
+func (h *handler) activateSubscriptions(jCodec serviceCodec) {
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+
+	if ntf := jCodec.notifier(); ntf != nil && len(h.subs) != 0 {
+		ntf.activate(h.subs)
+	}
+}
+
+func (h *handler) cancelSubscriptions(jCodec serviceCodec) {
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+
+	if ntf := jCodec.notifier(); ntf != nil {
+		for _, sub := range h.subs {
+			ntf.unsubscribe(sub.ID)
+		}
+	}
+}
+
+// logCalls writes access log of replied calls, size is number of bytes
+// of the written response.
+func (h *handler) logCalls(size int) {
+	h.logMu.Lock()
+	defer h.logMu.Unlock()
+
+	for _, c := range h.replied {
+		h.sr.accessLogging().log(c, size)
+	}
+
+	h.replied = nil
+}
+
 func (h *handler) handleMsgs(msgs []*jsonMessage) []*jsonMessage {
 	l := len(msgs)
 	h.msgsC = make([]chan *jsonMessage, 0, l)
@@ -62,93 +195,290 @@ func (h *handler) handleMsgs(msgs []*jsonMessage) []*jsonMessage {
 		h.handle(msg, msgC)
 	}
 
-	retMsgs := make([]*jsonMessage, l)
+	// notifications are waited as well, but never responded
+	retMsgs := make([]*jsonMessage, 0, l)
 	for i := 0; i < l; i++ {
-		retMsgs[i] = h.wait(msgs[i], h.msgsC[i])
+		retMsg := h.wait(msgs[i], h.msgsC[i])
+		if !msgs[i].isNotification() {
+			retMsgs = append(retMsgs, retMsg)
+		}
 	}
 
 	return retMsgs
 }
 
+// handleMsg returns nil if msg is a notification
 func (h *handler) handleMsg(msg *jsonMessage) *jsonMessage {
 	msgC := make(chan *jsonMessage, 1)
 	h.msgsC = append(h.msgsC, msgC)
 	h.handle(msg, msgC)
-	return h.wait(msg, msgC)
+
+	retMsg := h.wait(msg, msgC)
+	if msg.isNotification() {
+		return nil
+	}
+
+	return retMsg
 }
 
 func (h *handler) wait(msg *jsonMessage, msgC <-chan *jsonMessage) *jsonMessage {
-	timer := time.NewTimer(_defTimeout * time.Second)
-	defer timer.Stop()
+	retMsg := <-msgC
+	_xlog.Debug("Method completed", "message", msg)
 
-LOOP:
-	for {
-		select {
-		case retMsg := <-msgC:
-			_xlog.Info("Method completed", "message", msg)
-			if retMsg.hasErr() {
-				_failureReqeustCounter.Inc(1)
-			} else {
-				_successRequestCounter.Inc(1)
-			}
-			return retMsg
-		case <-timer.C:
-			_failureReqeustCounter.Inc(1)
-			break LOOP
-		}
+	switch {
+	case !retMsg.hasErr():
+		_successRequestCounter.Inc(1)
+	case retMsg.Error.Code == _errHandleTimeout.ErrorCode():
+		_timeoutRequestCounter.Inc(1)
+	default:
+		_failureReqeustCounter.Inc(1)
 	}
 
-	_xlog.Debug("Method run timeout", "message", msg)
-	return msg.errResponse(_errHandleTimeout)
+	return retMsg
 }
 
 func (h *handler) handle(msg *jsonMessage, msgC chan<- *jsonMessage) {
+	transport := transportFromContext(h.ctx)
+	ctx := h.ctx
+	if _, ok := RequestIDFromContext(ctx); !ok {
+		ctx, _ = withRequestID(ctx, "")
+	}
+
+	ctx, sp := h.sr.tracing().start(ctx, "handler.call")
+	sp.setAttr("rpc.transport", transport)
+	sp.setAttr("rpc.group", msg.Group)
+	sp.setAttr("rpc.service", msg.Service)
+	sp.setAttr("rpc.service_version", msg.ServiceVersion)
+	sp.setAttr("rpc.method", msg.Method)
+
+	c := &call{
+		ctx:     ctx,
+		msg:     msg,
+		start:   time.Now(),
+		version: msg.ServiceVersion,
+		m:       unresolvedMetrics(transport),
+		sp:      sp,
+	}
+
+	if !h.sr.calls.begin() {
+		h.reply(c, msgC, msg.errResponse(_errShuttingDown))
+		return
+	}
+
+	h.tracked++
 	if err := msg.doValidate(); err != nil {
 		_xlog.Debug("Message validation failure", "message", msg)
-		msgC <- msg.errResponse(err)
+		h.reply(c, msgC, msg.errResponse(err))
 		return
 	}
 
-	cb := h.sr.callback(msg.Group, msg.Service, msg.ServiceVersion, msg.Method)
-	if cb == nil {
-		_xlog.Debug("Method callback not found or not available",
-			"message", msg)
-		msgC <- msg.errResponse(_errMethodNotFound)
+	if util.FormatName(msg.Method) == _unsubscribeMethod {
+		h.reply(c, msgC, h.unsubscribe(msg))
 		return
 	}
 
-	args, err := msg.retrieveArgs(cb.argTypes)
+	srv, cb, req, err := h.lookup(msg)
 	if err != nil {
-		_xlog.Debug("Invalid message params", "message", msg, "err", err)
-		msgC <- msg.errResponse(err)
+		h.reply(c, msgC, msg.errResponse(err))
 		return
 	}
 
-	go func(c chan<- *jsonMessage) {
-		_xlog.Info("Method starting", "message", msg)
-		r, err := h.call(cb, msg.String(), args)
-		if err != nil {
-			c <- msg.errResponse(err)
+	// version is resolved by range
+	sp.setAttr("rpc.service_version", srv.version)
+	c.version = srv.version
+	c.m = methodMetricsOf(transport, util.FormatName(req.Group), srv.name,
+		srv.version, util.FormatName(req.Method))
+	m := c.m
+	allowed := cb.sem.tryAcquire()
+	if allowed && !h.sr.allow(h.ctx, req, srv) {
+		// nothing is taken by rejected requests
+		cb.sem.release()
+		allowed = false
+	}
+
+	if !allowed {
+		_xlog.Debug("Method rate limited", "message", msg)
+		h.reply(c, msgC, msg.errResponse(_errRateLimited))
+		return
+	}
+
+	// ctx of method is cancelled once it is timeout, or the connection
+	// is gone
+	ctx, cancel := context.WithTimeout(ctx, h.sr.timeoutOf(cb))
+	m.calls.Inc(1)
+	go func(ch chan<- *jsonMessage) {
+		defer cancel()
+		_xlog.Debug("Method starting", "message", msg)
+
+		start := time.Now()
+		m.inFlight.Inc(1)
+		done := make(chan *result, 1)
+		go func() {
+			defer m.inFlight.Dec(1)
+			defer cb.sem.release()
+			done <- h.run(ctx, cb, req, msg)
+		}()
+
+		var r *result
+		select {
+		case r = <-done:
+		case <-ctx.Done():
+		case <-h.sr.calls.aborted():
+			// server is shut down
+			cancel()
+		}
+
+		if r == nil {
+			// the method may be completed at the same time
+			select {
+			case r = <-done:
+			default:
+			}
+		}
+
+		// error of method is replaced, e.g. ctx.Err()
+		if r != nil && (!r.msg.hasErr() || ctx.Err() == nil) {
+			if r.sub != nil {
+				h.addSubscription(r.sub)
+			}
+
+			m.latency.UpdateSince(start)
+			h.reply(c, ch, r.msg)
+			return
+		}
+
+		m.latency.UpdateSince(start)
+		if ctx.Err() == context.DeadlineExceeded {
+			_xlog.Debug("Method run timeout", "message", msg)
+			h.reply(c, ch, msg.errResponse(_errHandleTimeout))
+		} else {
+			_xlog.Debug("Method canceled", "message", msg)
+			h.reply(c, ch, msg.errResponse(_errRequestCanceled))
+		}
+
+		if r != nil {
 			return
 		}
 
-		c <- msg.response(r)
+		// subscription of the abandoned method is never used
+		go func() {
+			if r := <-done; r.sub != nil {
+				r.sub.n.unsubscribe(r.sub.ID)
+			}
+		}()
 	}(msgC)
 }
 
-func (h *handler) call(cb *callback, msg string, args []reflect.Value) (result interface{}, err error) {
-	callArgs := make([]reflect.Value, 0, len(args)+2)
+// call is a message in handling, it is observed once it is replied
+type call struct {
+	ctx      context.Context
+	msg      *jsonMessage
+	start    time.Time
+	version  string
+	m        *methodMetrics
+	sp       *span
+	retMsg   *jsonMessage
+	duration time.Duration
+}
 
-	if cb.rcvr.IsValid() {
-		callArgs = append(callArgs, cb.rcvr)
+// reply sends response of message, errors are counted by code, the span
+// of message is ended and the call is kept for access log.
+func (h *handler) reply(c *call, ch chan<- *jsonMessage, retMsg *jsonMessage) {
+	if retMsg.hasErr() {
+		c.m.observeError(retMsg.Error.Code)
 	}
 
-	if cb.hasCtx {
-		callArgs = append(callArgs, reflect.ValueOf(h.ctx))
+	c.sp.end(retMsg)
+	if h.sr.accessLogging() != nil {
+		c.retMsg, c.duration = retMsg, time.Since(c.start)
+		h.logMu.Lock()
+		h.replied = append(h.replied, c)
+		h.logMu.Unlock()
 	}
 
-	callArgs = append(callArgs, args...)
+	ch <- retMsg
+}
+
+type result struct {
+	msg *jsonMessage
+	sub *Subscription
+}
+
+// run invokes the method, and returns its response
+func (h *handler) run(ctx context.Context, cb *callback, req *Request, msg *jsonMessage) *result {
+	r, err := h.invoke(ctx, cb, req, msg.String())
+	if err != nil {
+		return &result{msg: msg.errResponse(err)}
+	}
+
+	if !cb.isSubscribe {
+		return &result{msg: msg.response(r)}
+	}
+
+	sub, ok := r.(*Subscription)
+	ntf, _ := NotifierFromContext(ctx)
+	if !ok || sub == nil || sub.n != ntf {
+		_xlog.Debug("Invalid subscription", "message", msg)
+		return &result{msg: msg.errResponse(_errInternal)}
+	}
+
+	return &result{msg: msg.response(sub.ID), sub: sub}
+}
+
+// lookup returns service, callback and request of message. The method
+// returns subscription is only called by "subscribe" with params
+// [method, args...]
+func (h *handler) lookup(msg *jsonMessage) (*service, *callback, *Request, error) {
+	req := &Request{
+		ID:      msg.ID,
+		Group:   msg.Group,
+		Service: msg.Service,
+		Version: msg.ServiceVersion,
+		Method:  msg.Method,
+		Params:  msg.Params,
+	}
+
+	if req.Service == "" && msg.isDiscover() {
+		req.Service = _builtInService
+	}
+
+	if util.FormatName(msg.Method) == _subscribeMethod {
+		if _, ok := NotifierFromContext(h.ctx); !ok {
+			return nil, nil, nil, _errNotificationsUnsupported
+		}
+
+		name, params, err := msg.subscriptionArgs()
+		if err != nil {
+			_xlog.Debug("Invalid subscription params", "message", msg,
+				"err", err)
+			return nil, nil, nil, err
+		}
+
+		req.Method, req.Params, req.Subscription = name, params, true
+	}
+
+	srv, cb, err := h.sr.callback(req.Group, req.Service, req.Version, req.Method)
+	if err != nil {
+		_xlog.Debug("Method callback not found or not available",
+			"message", msg, "err", err)
+		return nil, nil, nil, err
+	}
+
+	if cb.isSubscribe != req.Subscription {
+		_xlog.Debug("Method callback not available", "message", msg)
+		return nil, nil, nil, _errMethodNotFound
+	}
+
+	if err := h.sr.authorize(h.ctx, req.Group, srv, req.Method); err != nil {
+		_xlog.Debug("Method not authorized", "message", msg, "err", err)
+		return nil, nil, nil, err
+	}
+
+	return srv, cb, req, nil
+}
 
+// invoke runs interceptors of request, and calls the method at the end
+func (h *handler) invoke(ctx context.Context, cb *callback, req *Request, msg string) (result interface{}, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			buf := make([]byte, 64<<10)
@@ -159,6 +489,52 @@ func (h *handler) call(cb *callback, msg string, args []reflect.Value) (result i
 		}
 	}()
 
+	final := func(ctx context.Context, req *Request) (interface{}, error) {
+		argsMsg := &jsonMessage{Params: req.Params}
+		args, err := argsMsg.retrieveArgs(cb.argTypes, cb.paramNames)
+		if err != nil {
+			_xlog.Debug("Invalid message params", "message", msg, "err", err)
+			return nil, err
+		}
+
+		return h.call(ctx, cb, args)
+	}
+
+	interceptors := h.sr.interceptors(req.Group, cb)
+	return chainInterceptors(interceptors, final)(ctx, req)
+}
+
+func (h *handler) unsubscribe(msg *jsonMessage) *jsonMessage {
+	ntf, ok := NotifierFromContext(h.ctx)
+	if !ok {
+		return msg.errResponse(_errNotificationsUnsupported)
+	}
+
+	var ids []ID
+	if err := json.Unmarshal(msg.Params, &ids); err != nil || len(ids) != 1 {
+		return msg.errResponse(_errInvalidParams)
+	}
+
+	if !ntf.unsubscribe(ids[0]) {
+		return msg.errResponse(_errSubscriptionNotFound)
+	}
+
+	return msg.response(true)
+}
+
+func (h *handler) call(ctx context.Context, cb *callback, args []reflect.Value) (interface{}, error) {
+	callArgs := make([]reflect.Value, 0, len(args)+2)
+
+	if cb.rcvr.IsValid() {
+		callArgs = append(callArgs, cb.rcvr)
+	}
+
+	if cb.hasCtx {
+		callArgs = append(callArgs, reflect.ValueOf(ctx))
+	}
+
+	callArgs = append(callArgs, args...)
+
 	_requestCounter.Inc(1)
 
 	r := cb.fn.Call(callArgs)
@@ -0,0 +1,294 @@
+package anserpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Crit(msg string, ctx ...interface{})  {}
+func (nopLogger) Warn(msg string, ctx ...interface{})  {}
+func (nopLogger) Error(msg string, ctx ...interface{}) {}
+func (nopLogger) Info(msg string, ctx ...interface{})  {}
+func (nopLogger) Debug(msg string, ctx ...interface{}) {}
+
+func TestMain(m *testing.M) {
+	newSafeLogger(&logOpt{logger: nopLogger{}})
+	os.Exit(m.Run())
+}
+
+type testConn struct {
+	*strings.Reader
+	out bytes.Buffer
+}
+
+func (t *testConn) Write(b []byte) (int, error) { return t.out.Write(b) }
+
+func (t *testConn) Close() error { return nil }
+
+func (t *testConn) SetWriteDeadline(time.Time) error { return nil }
+
+type counter struct {
+	n int64
+}
+
+func (c *counter) Incr() (int64, error) { return atomic.AddInt64(&c.n, 1), nil }
+
+func (c *counter) Add(a, b int) (int, error) { return a + b, nil }
+
+func newTestRegistry(rcvr interface{}) *serviceRegistry {
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{
+		Service:  "test",
+		Version:  "1.0",
+		Public:   true,
+		Receiver: rcvr,
+	})
+
+	return sr
+}
+
+// serve handles the request with a json codec, and returns what is
+// written back and whether doHandle responds.
+func serve(t *testing.T, sr *serviceRegistry, req string) (string, bool) {
+	t.Helper()
+
+	conn := &testConn{Reader: strings.NewReader(req)}
+	jcodec := newCodec(conn)
+	defer jcodec.close()
+
+	responded := doHandle(context.Background(), jcodec, sr)
+	return strings.TrimSpace(conn.out.String()), responded
+}
+
+func TestHandleRequest(t *testing.T) {
+	sr := newTestRegistry(&counter{})
+
+	out, responded := serve(t, sr,
+		`{"jsonrpc":"2.0","id":1,"service":"test","method":"add","params":[1,2]}`)
+	if !responded {
+		t.Fatal("request is not responded")
+	}
+
+	var resp jsonMessage
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", out, err)
+	}
+
+	if string(resp.ID) != "1" || string(resp.Result) != "3" {
+		t.Errorf("response = %s, want id 1 and result 3", out)
+	}
+}
+
+func TestHandleNotification(t *testing.T) {
+	c := &counter{}
+	sr := newTestRegistry(c)
+
+	out, responded := serve(t, sr,
+		`{"jsonrpc":"2.0","service":"test","method":"incr"}`)
+	if responded || out != "" {
+		t.Errorf("notification is responded: %q", out)
+	}
+
+	if atomic.LoadInt64(&c.n) != 1 {
+		t.Errorf("method is called %d times, want 1", c.n)
+	}
+
+	// errors of notification are not reported either
+	out, responded = serve(t, sr,
+		`{"jsonrpc":"2.0","service":"test","method":"notfound"}`)
+	if responded || out != "" {
+		t.Errorf("failed notification is responded: %q", out)
+	}
+}
+
+func TestHandleBatchNotifications(t *testing.T) {
+	c := &counter{}
+	sr := newTestRegistry(c)
+
+	out, responded := serve(t, sr, `[
+		{"jsonrpc":"2.0","service":"test","method":"incr"},
+		{"jsonrpc":"2.0","service":"test","method":"incr"}
+	]`)
+	if responded || out != "" {
+		t.Errorf("batch of notifications is responded: %q", out)
+	}
+
+	if atomic.LoadInt64(&c.n) != 2 {
+		t.Errorf("method is called %d times, want 2", c.n)
+	}
+}
+
+func TestHandleMixedBatch(t *testing.T) {
+	c := &counter{}
+	sr := newTestRegistry(c)
+
+	out, responded := serve(t, sr, `[
+		{"jsonrpc":"2.0","service":"test","method":"incr"},
+		{"jsonrpc":"2.0","id":"a","service":"test","method":"add","params":[1,2]},
+		{"jsonrpc":"2.0","service":"test","method":"notfound"},
+		{"jsonrpc":"2.0","id":"b","service":"test","method":"notfound"}
+	]`)
+	if !responded {
+		t.Fatal("batch is not responded")
+	}
+
+	var resps []*jsonMessage
+	if err := json.Unmarshal([]byte(out), &resps); err != nil {
+		t.Fatalf("invalid response %q: %v", out, err)
+	}
+
+	if len(resps) != 2 {
+		t.Fatalf("got %d responses, want 2: %s", len(resps), out)
+	}
+
+	if string(resps[0].ID) != `"a"` || string(resps[0].Result) != "3" {
+		t.Errorf("response 0 = %s, want id a and result 3", out)
+	}
+
+	if string(resps[1].ID) != `"b"` || !resps[1].hasErr() ||
+		resps[1].Error.Code != _errMethodNotFound.ErrorCode() {
+		t.Errorf("response 1 = %s, want id b and method not found", out)
+	}
+
+	if atomic.LoadInt64(&c.n) != 1 {
+		t.Errorf("method is called %d times, want 1", c.n)
+	}
+}
+
+func TestHandleEmptyBatch(t *testing.T) {
+	out, responded := serve(t, newTestRegistry(&counter{}), `[]`)
+	if !responded {
+		t.Fatal("empty batch is not responded")
+	}
+
+	var resp jsonMessage
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", out, err)
+	}
+
+	if !resp.hasErr() || resp.Error.Code != _errInvalidRequest.ErrorCode() {
+		t.Errorf("response = %s, want invalid request", out)
+	}
+}
+
+type point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type geometry struct{}
+
+func (g *geometry) Move(p point) (point, error) { return point{p.X + 1, p.Y + 1}, nil }
+
+func (g *geometry) Scale(p *point, n int, unit *string) (int, error) {
+	if unit != nil {
+		return -1, nil
+	}
+
+	return (p.X + p.Y) * n, nil
+}
+
+func newGeometryRegistry(t *testing.T) *serviceRegistry {
+	t.Helper()
+
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{
+		Service:  "geometry",
+		Public:   true,
+		Receiver: &geometry{},
+		ParamNames: map[string][]string{
+			"Scale": {"p", "n", "unit"},
+		},
+	})
+
+	if _, cb, _ := sr.callback("", "geometry", "", "scale"); cb == nil {
+		t.Fatal("service geometry is not registered")
+	}
+
+	return sr
+}
+
+func TestHandleNamedParams(t *testing.T) {
+	sr := newGeometryRegistry(t)
+
+	tests := []struct {
+		params string
+		result string
+		code   int
+	}{
+		// object decoded into the only struct arg
+		{`"method":"move","params":{"x":1,"y":2}`, `{"x":2,"y":3}`, 0},
+		{`"method":"move","params":[{"x":1,"y":2}]`, `{"x":2,"y":3}`, 0},
+		// object mapped onto args by names, unit is optional
+		{`"method":"scale","params":{"n":2,"p":{"x":1,"y":2}}`, `6`, 0},
+		{`"method":"scale","params":{"n":2,"p":{"x":1},"unit":"cm"}`, `-1`, 0},
+		{`"method":"scale","params":{"p":{"x":1}}`, ``,
+			_errMissingValueParams.ErrorCode()},
+		{`"method":"scale","params":{"n":null,"p":{"x":1}}`, ``,
+			_errMissingValueParams.ErrorCode()},
+		{`"method":"scale","params":{"n":2,"p":{"x":1},"z":1}`, ``,
+			_errInvalidParams.ErrorCode()},
+		{`"method":"scale","params":{"n":2,"p":{"x":1},"unit":"cm","z":1}`, ``,
+			_errTooManyParams.ErrorCode()},
+		{`"method":"scale","params":[{"x":1},2,null,4]`, ``,
+			_errTooManyParams.ErrorCode()},
+		{`"method":"scale","params":"x"`, ``, _errInvalidParams.ErrorCode()},
+	}
+
+	for _, test := range tests {
+		out, _ := serve(t, sr, `{"jsonrpc":"2.0","id":1,"service":"geometry",`+
+			test.params+`}`)
+
+		var resp jsonMessage
+		if err := json.Unmarshal([]byte(out), &resp); err != nil {
+			t.Fatalf("invalid response %q: %v", out, err)
+		}
+
+		if test.code != 0 {
+			if !resp.hasErr() || resp.Error.Code != test.code {
+				t.Errorf("%s: response = %s, want error %d", test.params,
+					out, test.code)
+			}
+
+			continue
+		}
+
+		if resp.hasErr() || string(resp.Result) != test.result {
+			t.Errorf("%s: response = %s, want result %s", test.params, out,
+				test.result)
+		}
+	}
+}
+
+func TestRegisterParamNamesMismatch(t *testing.T) {
+	for _, names := range [][]string{
+		{"p"},
+		{"p", "n", "p"},
+	} {
+		api := &API{
+			Service:  "geometry",
+			Public:   true,
+			Receiver: &geometry{},
+			ParamNames: map[string][]string{
+				"Scale": names,
+			},
+		}
+
+		_, err := makeService(api)
+		if err == nil {
+			t.Errorf("service is made with param names %v", names)
+		}
+
+		if _, ok := err.(StatusError); ok {
+			t.Errorf("param names %v: %v, want a registration error", names, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package anserpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	_defHealthPath         = "/healthz"
+	_defReadyPath          = "/readyz"
+	_defHealthCheckTimeout = 5 * time.Second
+
+	HealthPass = "pass"
+	HealthFail = "fail"
+)
+
+// HealthChecker reports whether a service or the application is healthy.
+// Receivers of registered services which implement it are checked as
+// "group/service_version".
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// ReadyChecker reports whether a service is ready to serve, the
+// application is not ready until all of them are ready.
+type ReadyChecker interface {
+	CheckReady(ctx context.Context) error
+}
+
+// HealthCheck is the result of a checker
+type HealthCheck struct {
+	Name string `json:"name"`
+	// "health" or "ready"
+	Kind      string  `json:"kind"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// HealthReport is the result of all checkers. Status is pass if all
+// health checks pass, and it is ready if all checks pass and the
+// application is not shutting down.
+type HealthReport struct {
+	Status string         `json:"status"`
+	Ready  bool           `json:"ready"`
+	Checks []*HealthCheck `json:"checks"`
+}
+
+type healthChecker struct {
+	name string
+	kind string
+	fn   func(ctx context.Context) error
+}
+
+// checkersOf returns checkers implemented by v
+func checkersOf(name string, v interface{}) []*healthChecker {
+	var checkers []*healthChecker
+	if c, ok := v.(HealthChecker); ok {
+		checkers = append(checkers, &healthChecker{name, "health", c.CheckHealth})
+	}
+
+	if c, ok := v.(ReadyChecker); ok {
+		checkers = append(checkers, &healthChecker{name, "ready", c.CheckReady})
+	}
+
+	return checkers
+}
+
+func (h *healthChecker) run(ctx context.Context) *HealthCheck {
+	start := time.Now()
+	err := h.fn(ctx)
+	check := &HealthCheck{
+		Name:      h.name,
+		Kind:      h.kind,
+		Status:    HealthPass,
+		LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+
+	if err != nil {
+		check.Status = HealthFail
+		check.Error = err.Error()
+	}
+
+	return check
+}
+
+// registerChecker registers checkers implemented by c of the application
+func (s *serviceRegistry) registerChecker(name string, c HealthChecker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkers = append(s.checkers, checkersOf(name, c)...)
+}
+
+// allCheckers returns checkers of the application and services
+func (s *serviceRegistry) allCheckers() []*healthChecker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkers := append([]*healthChecker(nil), s.checkers...)
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		for _, srv := range s.groups[name].services {
+			checkers = append(checkers, srv.checkers...)
+		}
+	}
+
+	return checkers
+}
+
+// checkHealth runs all checkers concurrently until ctx is done, checkers
+// which are not completed by then fail with error of ctx.
+func (s *serviceRegistry) checkHealth(ctx context.Context) *HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, _defHealthCheckTimeout)
+	defer cancel()
+
+	checkers := s.allCheckers()
+	report := &HealthReport{
+		Status: HealthPass,
+		Ready:  !s.calls.isDraining(),
+		Checks: make([]*HealthCheck, len(checkers)),
+	}
+
+	type checked struct {
+		i     int
+		check *HealthCheck
+	}
+
+	start := time.Now()
+	checkedC := make(chan checked, len(checkers))
+	for i, c := range checkers {
+		go func(i int, c *healthChecker) {
+			checkedC <- checked{i, c.run(ctx)}
+		}(i, c)
+	}
+
+wait:
+	for range checkers {
+		select {
+		case c := <-checkedC:
+			report.Checks[c.i] = c.check
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	for i, check := range report.Checks {
+		if check == nil {
+			report.Checks[i] = &HealthCheck{
+				Name:      checkers[i].name,
+				Kind:      checkers[i].kind,
+				Status:    HealthFail,
+				Error:     ctx.Err().Error(),
+				LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+			}
+		}
+	}
+
+	for _, check := range report.Checks {
+		if check.Status == HealthPass {
+			continue
+		}
+
+		report.Ready = false
+		if check.Kind == "health" {
+			report.Status = HealthFail
+		}
+	}
+
+	return report
+}
+
+// healthHandler responds reports of health and readiness on their
+// paths, other requests are passed to next.
+type healthHandler struct {
+	sr   *serviceRegistry
+	next http.Handler
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != _defHealthPath && r.URL.Path != _defReadyPath {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := h.sr.checkHealth(r.Context())
+	ok := report.Status == HealthPass
+	if r.URL.Path == _defReadyPath {
+		ok = report.Ready
+	}
+
+	w.Header().Set("content-type", _defAppJson)
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+func newHealthHandler(sr *serviceRegistry, next http.Handler) http.Handler {
+	return &healthHandler{
+		sr:   sr,
+		next: next,
+	}
+}
@@ -0,0 +1,162 @@
+package anserpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type warmup struct {
+	mu    sync.Mutex
+	ready bool
+}
+
+func (w *warmup) Get() (int, error) { return 1, nil }
+
+func (w *warmup) CheckHealth(ctx context.Context) error { return nil }
+
+func (w *warmup) CheckReady(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.ready {
+		return errors.New("warming up")
+	}
+
+	return nil
+}
+
+type checkerFunc func(ctx context.Context) error
+
+func (f checkerFunc) CheckHealth(ctx context.Context) error { return f(ctx) }
+
+func getHealth(t *testing.T, url string) (int, *HealthReport) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var report HealthReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, &report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	w := &warmup{}
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{Group: "g", Service: "warmup", Version: "1.0",
+		Public: true, Receiver: w})
+
+	ts := httptest.NewServer(newHttpServer(withDefaultHTTPOpt(), sr, nil).head)
+	defer ts.Close()
+
+	// healthy, but not ready until the service is warmed up
+	if code, report := getHealth(t, ts.URL+_defHealthPath); code != http.StatusOK ||
+		report.Status != HealthPass || len(report.Checks) != 2 {
+		t.Errorf("healthz = %d %+v, want pass", code, report)
+	}
+
+	code, report := getHealth(t, ts.URL+_defReadyPath)
+	if code != http.StatusServiceUnavailable || report.Ready {
+		t.Errorf("readyz = %d %+v, want not ready", code, report)
+	}
+
+	for _, check := range report.Checks {
+		if check.Name != "g/warmup_1.0" {
+			t.Errorf("check name = %s, want g/warmup_1.0", check.Name)
+		}
+
+		if check.Kind == "ready" && (check.Status != HealthFail || check.Error != "warming up") {
+			t.Errorf("ready check = %+v, want warming up", check)
+		}
+	}
+
+	w.mu.Lock()
+	w.ready = true
+	w.mu.Unlock()
+
+	if code, report := getHealth(t, ts.URL+_defReadyPath); code != http.StatusOK || !report.Ready {
+		t.Errorf("readyz = %d %+v, want ready", code, report)
+	}
+
+	// a failed health check of the application fails both
+	sr.registerChecker("db", checkerFunc(func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+
+	for _, path := range []string{_defHealthPath, _defReadyPath} {
+		if code, report := getHealth(t, ts.URL+path); code != http.StatusServiceUnavailable ||
+			report.Status != HealthFail || report.Ready {
+			t.Errorf("%s = %d %+v, want fail", path, code, report)
+		}
+	}
+}
+
+func TestHealthRPC(t *testing.T) {
+	sr := newTestRegistry(&warmup{ready: true})
+	sr.registerChecker("app", checkerFunc(func(ctx context.Context) error { return nil }))
+
+	resp := serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"service":"built-in","method":"health"}`)
+	var report HealthReport
+	if err := json.Unmarshal(resp.Result, &report); err != nil {
+		t.Fatalf("response = %+v: %v", resp, err)
+	}
+
+	if report.Status != HealthPass || !report.Ready || len(report.Checks) != 3 ||
+		report.Checks[0].Name != "app" {
+		t.Errorf("report = %+v, want 3 passed checks", report)
+	}
+
+	// checkers are not methods of service
+	resp = serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"service":"test","method":"checkready"}`)
+	if !resp.hasErr() || resp.Error.Code != _errMethodNotFound.ErrorCode() {
+		t.Errorf("response = %+v, want method not found", resp)
+	}
+
+	// not ready once it is shutting down
+	sr.calls.drain()
+	if report := sr.checkHealth(context.Background()); report.Ready {
+		t.Errorf("report = %+v, want not ready", report)
+	}
+}
+
+func TestHealthCheckCanceled(t *testing.T) {
+	sr := newServiceRegistry()
+	release := make(chan struct{})
+	defer close(release)
+
+	sr.registerChecker("stuck", checkerFunc(func(ctx context.Context) error {
+		<-release
+		return nil
+	}))
+	sr.registerChecker("quick", checkerFunc(func(ctx context.Context) error { return nil }))
+
+	// checkers ignoring ctx do not block the report
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	report := sr.checkHealth(ctx)
+	if report.Status != HealthFail || len(report.Checks) != 2 {
+		t.Fatalf("report = %+v, want fail", report)
+	}
+
+	if c := report.Checks[0]; c.Name != "stuck" || c.Status != HealthFail ||
+		c.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("check = %+v, want deadline exceeded", c)
+	}
+
+	if c := report.Checks[1]; c.Name != "quick" || c.Status != HealthPass {
+		t.Errorf("check = %+v, want pass", c)
+	}
+}
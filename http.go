@@ -3,6 +3,8 @@ package anserpc
 import (
 	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -35,12 +37,27 @@ type httpOpt struct {
 	deniedMethods       util.StringSet
 	allowedContentTypes util.StringSet
 	WebsocketAllowed    bool
+	websocketInFlight   int
+	tls                 *tlsOpt
+	metricsPath         string
+	cors                *corsOpt
 }
 
 func (h *httpOpt) apply(opts *options) {
 	opts.http.vhosts.Merge(h.vhosts)
 	opts.http.deniedMethods.Merge(h.deniedMethods)
 	opts.http.allowedContentTypes.Merge(h.allowedContentTypes)
+	if h.metricsPath != "" {
+		opts.http.metricsPath = h.metricsPath
+	}
+
+	if h.websocketInFlight > 0 {
+		opts.http.websocketInFlight = h.websocketInFlight
+	}
+
+	if h.cors != nil {
+		opts.http.cors = h.cors
+	}
 }
 
 type validateHandler struct {
@@ -70,9 +87,11 @@ func (v *validateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// allow OPTIONS
+	// OPTIONS is answered with allowed methods, preflight requests of
+	// CORS are answered before
 	if r.Method == http.MethodOptions {
-		v.next.ServeHTTP(w, r)
+		w.Header().Set("Allow", strings.Join(allowedMethods(v.deniedMethods), ", "))
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
@@ -148,6 +167,10 @@ func (g *gzipResponseWriter) Write(b []byte) (int, error) {
 
 func (g *gzipResponseWriter) WriteHeader(statusCode int) {
 	g.Header().Del("Content-Length")
+	if statusCode == http.StatusNoContent {
+		g.Header().Del("Content-Encoding")
+	}
+
 	g.ResponseWriter.WriteHeader(statusCode)
 }
 
@@ -188,14 +211,34 @@ var gwPool = sync.Pool{
 type httpServerConn struct {
 	io.Reader
 	io.Writer
+	w http.ResponseWriter
+}
+
+func (h *httpServerConn) setStatus(code int) {
+	h.w.WriteHeader(code)
 }
 
 func (h *httpServerConn) Close() error { return nil }
 
 func (h *httpServerConn) SetWriteDeadline(time.Time) error { return nil }
 
+// writeHTTPError responds err with status in format f before any
+// message is read, e.g. the request is rejected by authentication. It
+// returns number of bytes written.
+func writeHTTPError(ctx context.Context, w http.ResponseWriter, f *wireFormat, status int, err error) int {
+	w.Header().Set("content-type", f.contentType)
+
+	jcodec := newFormatCodec(&httpServerConn{Writer: w, w: w}, f)
+	defer jcodec.close()
+
+	jcodec.setStatus(status)
+	n, _ := jcodec.writeTo(ctx, makeJSONErrorMessage(err))
+	return n
+}
+
 type httpServer struct {
 	sr       *serviceRegistry
+	auth     authOpt
 	opt      *httpOpt
 	mu       sync.Mutex
 	listener net.Listener
@@ -204,17 +247,23 @@ type httpServer struct {
 	endpoint *rpcEndpoint
 	head     http.Handler
 	codecs   *codecSet
+	certs    *certReloader
 }
 
-func newHttpServer(opt *httpOpt, sr *serviceRegistry) *httpServer {
+func newHttpServer(opt *httpOpt, sr *serviceRegistry, auth authOpt) *httpServer {
 	server := &httpServer{
 		sr:     sr,
+		auth:   auth,
 		opt:    opt,
 		err:    make(chan error),
 		codecs: newCodecSet(),
 	}
 
 	server.head = newValidateHandler(opt, server)
+	server.head = newMetricsHandler(opt, server.head)
+	server.head = newHealthHandler(sr, server.head)
+	// hosts are validated before requests of CORS are answered
+	server.head = newCorsHandler(opt, server.head)
 	server.head = newVirtualHostHandler(opt, server.head)
 	server.head = newGzipWriteHandler(server.head)
 	server.head = newWebsocketHandler(opt, server, server.head)
@@ -261,20 +310,44 @@ func (h *httpServer) start() error {
 		return nil
 	}
 
+	var config *tls.Config
+	if h.opt.tls != nil {
+		var err error
+		if config, h.certs, err = h.opt.tls.serverConfig(); err != nil {
+			return err
+		}
+	}
+
 	listener, err := net.Listen("tcp", h.endpoint.String())
 	if err != nil {
 		return err
 	}
 
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+
 	h.listener = listener
 	h.server = &http.Server{Handler: h.head}
 
-	go h.serve()
+	go h.serve(h.server, listener)
 	return nil
 }
 
-func (h *httpServer) serve() {
-	h.err <- h.server.Serve(h.listener)
+// reloadCertificate loads the certificate of WithTLSOpt again
+func (h *httpServer) reloadCertificate() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.certs == nil {
+		return errors.New("TLS certificate is not configured")
+	}
+
+	return h.certs.reload()
+}
+
+func (h *httpServer) serve(server *http.Server, listener net.Listener) {
+	h.err <- server.Serve(listener)
 }
 
 func (h *httpServer) wait() {
@@ -283,6 +356,30 @@ func (h *httpServer) wait() {
 	}
 }
 
+// shutdown stops accepting connections, and waits for HTTP requests in
+// handling until ctx is done. Websocket connections are not waited.
+func (h *httpServer) shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.server == nil {
+		return nil
+	}
+
+	return h.server.Shutdown(ctx)
+}
+
+// goingAway sends close frames to Websocket clients
+func (h *httpServer) goingAway(reason string) {
+	h.codecs.each(func(sc serviceCodec) bool {
+		if g, ok := sc.(goingAwayCodec); ok {
+			g.goingAway(reason)
+		}
+
+		return false
+	})
+}
+
 func (h *httpServer) stop() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -294,30 +391,55 @@ func (h *httpServer) doStop() {
 		return
 	}
 
-	h.codecs.close()
-	h.server.Shutdown(context.Background())
+	// no connection is accepted before the others are closed
+	h.server.Close()
 	h.listener.Close()
+	h.codecs.close()
 
 	h.endpoint = (*rpcEndpoint)(nil)
 	h.server, h.listener = nil, nil
 }
 
 func (h *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", _defAppJson)
-
-	ctx := r.Context()
-	ctx = context.WithValue(ctx, "anser-remote", r.RemoteAddr)
+	start := time.Now()
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("content-type"))
+	f := formatOfContentType(mediaType)
+	w.Header().Set("content-type", f.contentType)
 
 	conn := &httpServerConn{
 		Reader: io.LimitReader(r.Body, _maxReqContentLength),
 		Writer: w,
+		w:      w,
 	}
 
-	jcodec := newCodec(conn)
+	jcodec := newFormatCodec(conn, f)
 	defer jcodec.close()
 
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, "anser-remote", r.RemoteAddr)
+	ctx = context.WithValue(ctx, "anser-transport", TransportHTTP)
+	ctx = withClientCert(ctx, r.TLS)
+	ctx = withTraceHeader(ctx, r.Header)
+	ctx = withHTTPRequestID(ctx, w, r)
+
+	ctx, err := h.auth.authenticate(ctx, &AuthInfo{
+		Transport:  TransportHTTP,
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header,
+		TLS:        r.TLS,
+	})
+	if err != nil {
+		n := writeHTTPError(ctx, w, f, http.StatusUnauthorized, err)
+		h.sr.accessLogging().logRejected(ctx, r.RemoteAddr, start, err, n)
+		return
+	}
+
 	h.codecs.add(jcodec)
 	defer h.codecs.remove(jcodec)
 
-	doHandle(ctx, jcodec, h.sr)
+	// nothing is responded to notifications
+	if !doHandle(ctx, jcodec, h.sr) {
+		w.Header().Del("content-type")
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
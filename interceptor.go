@@ -0,0 +1,53 @@
+package anserpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Request is the parsed request passed to interceptors. Params can be
+// replaced before calling next, args of method are decoded from it.
+type Request struct {
+	ID      json.RawMessage
+	Group   string
+	Service string
+	Version string
+	Method  string
+	Params  json.RawMessage
+
+	// the method is called by "subscribe"
+	Subscription bool
+}
+
+func (r *Request) IsNotification() bool {
+	return len(r.ID) == 0
+}
+
+// Invoker invokes the next interceptor, or the method at the end of chain.
+type Invoker func(ctx context.Context, req *Request) (interface{}, error)
+
+// Interceptor runs around method invocation, it can reject the request
+// by returning an error without calling next. Interceptors are run in
+// order: global(Option), group and service(API).
+type Interceptor func(ctx context.Context, req *Request, next Invoker) (interface{}, error)
+
+type interceptorOpt []Interceptor
+
+func (i interceptorOpt) apply(opts *options) {
+	opts.interceptors = append(opts.interceptors, i...)
+}
+
+func WithInterceptorOpt(interceptors ...Interceptor) Option {
+	return interceptorOpt(interceptors)
+}
+
+func chainInterceptors(interceptors []Interceptor, final Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, next := interceptors[i], final
+		final = func(ctx context.Context, req *Request) (interface{}, error) {
+			return ic(ctx, req, next)
+		}
+	}
+
+	return final
+}
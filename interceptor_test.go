@@ -0,0 +1,135 @@
+package anserpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type echo struct{}
+
+func (e *echo) Say(ctx context.Context, s string) (string, error) {
+	if v, ok := ctx.Value("echo-prefix").(string); ok {
+		return v + s, nil
+	}
+
+	return s, nil
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) interceptor(name string) Interceptor {
+	return func(ctx context.Context, req *Request, next Invoker) (interface{}, error) {
+		r.mu.Lock()
+		r.calls = append(r.calls, name+":"+req.Method)
+		r.mu.Unlock()
+		return next(ctx, req)
+	}
+}
+
+func (r *recorder) reset() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	calls := r.calls
+	r.calls = nil
+	return calls
+}
+
+func newInterceptorRegistry(rec *recorder, service ...Interceptor) *serviceRegistry {
+	sr := newServiceRegistry()
+	sr.use(rec.interceptor("global"))
+
+	grp := newGroupRegister("g", sr)
+	grp.Use(rec.interceptor("group"))
+	sr.registerWithAPI(&API{
+		Group:        "g",
+		Service:      "echo",
+		Public:       true,
+		Receiver:     &echo{},
+		Interceptors: append([]Interceptor{rec.interceptor("service")}, service...),
+	})
+
+	return sr
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	rec := &recorder{}
+	sr := newInterceptorRegistry(rec)
+
+	out, _ := serve(t, sr,
+		`{"jsonrpc":"2.0","id":1,"group":"g","service":"echo","method":"say","params":["hi"]}`)
+	if !strings.Contains(out, `"result":"hi"`) {
+		t.Errorf("response = %s, want result hi", out)
+	}
+
+	want := "global:say,group:say,service:say"
+	if got := strings.Join(rec.reset(), ","); got != want {
+		t.Errorf("interceptors = %s, want %s", got, want)
+	}
+
+	// each message of batch runs the chain
+	out, _ = serve(t, sr, `[
+		{"jsonrpc":"2.0","id":1,"group":"g","service":"echo","method":"say","params":["a"]},
+		{"jsonrpc":"2.0","id":2,"group":"g","service":"echo","method":"say","params":["b"]}
+	]`)
+
+	var resps []*jsonMessage
+	if err := json.Unmarshal([]byte(out), &resps); err != nil || len(resps) != 2 {
+		t.Fatalf("invalid batch response %q: %v", out, err)
+	}
+
+	if n := len(rec.reset()); n != 6 {
+		t.Errorf("interceptors run %d times for batch, want 6", n)
+	}
+}
+
+func TestInterceptorReject(t *testing.T) {
+	rec := &recorder{}
+	denied := StatusError{code: -1, err: "denied"}
+	sr := newInterceptorRegistry(rec,
+		func(ctx context.Context, req *Request, next Invoker) (interface{}, error) {
+			return nil, denied
+		})
+
+	out, _ := serve(t, sr,
+		`{"jsonrpc":"2.0","id":1,"group":"g","service":"echo","method":"say","params":["hi"]}`)
+
+	var resp jsonMessage
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", out, err)
+	}
+
+	if !resp.hasErr() || resp.Error.Code != -1 {
+		t.Errorf("response = %s, want error -1", out)
+	}
+}
+
+func TestInterceptorRewrite(t *testing.T) {
+	rec := &recorder{}
+	sr := newInterceptorRegistry(rec,
+		func(ctx context.Context, req *Request, next Invoker) (interface{}, error) {
+			var params []string
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return nil, errors.New("bad params")
+			}
+
+			// sanitise params and pass value to method by ctx
+			params[0] = strings.TrimSpace(params[0])
+			req.Params, _ = json.Marshal(params)
+			ctx = context.WithValue(ctx, "echo-prefix", "#")
+			return next(ctx, req)
+		})
+
+	out, _ := serve(t, sr,
+		`{"jsonrpc":"2.0","id":1,"group":"g","service":"echo","method":"say","params":["  hi  "]}`)
+	if !strings.Contains(out, `"result":"#hi"`) {
+		t.Errorf("response = %s, want result #hi", out)
+	}
+}
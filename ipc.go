@@ -2,11 +2,13 @@ package anserpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/chao77977/anserpc/util"
 )
@@ -15,23 +17,139 @@ const (
 	_maxPathLength = 128
 )
 
+var _errMessageTooLarge = errors.New("message is too large")
+
 type ipcServerConn struct {
 	io.Reader
 	WriteCloserAndDeadline
 }
 
+// messageReader limits size of every message read from the connection,
+// but not the whole connection.
+type messageReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *messageReader) Read(p []byte) (int, error) {
+	if m.n <= 0 {
+		return 0, _errMessageTooLarge
+	}
+
+	if int64(len(p)) > m.n {
+		p = p[:m.n]
+	}
+
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	return n, err
+}
+
+func (m *messageReader) reset() {
+	m.n = _maxReqContentLength
+}
+
+// idleCloser closes the connection once it has no calls in handling, nor
+// subscriptions, for timeout. It does nothing if timeout is zero.
+type idleCloser struct {
+	mu         sync.Mutex
+	timeout    time.Duration
+	busy       int
+	timer      *time.Timer
+	subscribed func() bool
+}
+
+func newIdleCloser(timeout time.Duration, close func(), subscribed func() bool) *idleCloser {
+	c := &idleCloser{
+		timeout:    timeout,
+		subscribed: subscribed,
+	}
+
+	if timeout <= 0 {
+		return c
+	}
+
+	// the timer is read by its func under the lock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.timer = time.AfterFunc(timeout, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.busy != 0 {
+			return
+		}
+
+		if c.subscribed() {
+			c.timer.Reset(c.timeout)
+			return
+		}
+
+		_xlog.Debug("Close idle IPC connection")
+		close()
+	})
+
+	return c
+}
+
+func (c *idleCloser) begin() {
+	if c.timer == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.busy++
+	c.timer.Stop()
+}
+
+func (c *idleCloser) end() {
+	if c.timer == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.busy--; c.busy == 0 {
+		c.timer.Reset(c.timeout)
+	}
+}
+
+func (c *idleCloser) stop() {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
 type ipcServer struct {
 	sr       *serviceRegistry
+	auth     authOpt
 	mu       sync.Mutex
 	listener net.Listener
 	endpoint ipcEndpoint
 	err      chan error
+	codecs   *codecSet
+	format   *wireFormat
+	idle     time.Duration
 }
 
-func newIPCServer(sr *serviceRegistry) *ipcServer {
+// newIPCServer returns IPC server, messages are JSON if f is nil, and
+// connections are never closed as idle if idle is zero.
+func newIPCServer(sr *serviceRegistry, auth authOpt, f *wireFormat, idle time.Duration) *ipcServer {
+	if f == nil {
+		f = _jsonFormat
+	}
+
 	return &ipcServer{
-		sr:  sr,
-		err: make(chan error),
+		sr:     sr,
+		auth:   auth,
+		err:    make(chan error),
+		codecs: newCodecSet(),
+		format: f,
+		idle:   idle,
 	}
 }
 
@@ -42,6 +160,13 @@ func (i *ipcServer) isRunning() bool {
 	return i.listener != nil
 }
 
+func (i *ipcServer) path() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return string(i.endpoint)
+}
+
 func (i *ipcServer) setPath(endpoint ipcEndpoint) error {
 	if len(endpoint) > _maxPathLength {
 		return fmt.Errorf("IPC endpoint is longer that %d characters",
@@ -75,13 +200,13 @@ func (i *ipcServer) start() error {
 	os.Chmod(string(i.endpoint), 0600)
 	i.listener = listener
 
-	go i.serve()
+	go i.serve(listener)
 	return nil
 }
 
-func (i *ipcServer) serve() {
+func (i *ipcServer) serve(listener net.Listener) {
 	for {
-		conn, err := i.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			if util.IsTemporaryError(err) {
 				continue
@@ -91,7 +216,7 @@ func (i *ipcServer) serve() {
 			return
 		}
 
-		i.serveIPC(conn)
+		go i.serveIPC(conn)
 	}
 }
 
@@ -101,9 +226,20 @@ func (i *ipcServer) wait() {
 	}
 }
 
+// closeListener stops accepting connections, connections are kept
+// until stop.
+func (i *ipcServer) closeListener() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.listener != nil {
+		i.listener.Close()
+	}
+}
+
 func (i *ipcServer) stop() {
 	i.mu.Lock()
-	defer i.mu.Lock()
+	defer i.mu.Unlock()
 	i.doStop()
 }
 
@@ -113,21 +249,78 @@ func (i *ipcServer) doStop() {
 	}
 
 	i.listener.Close()
+	i.codecs.close()
 	i.endpoint = (ipcEndpoint)("")
 	i.listener = nil
 }
 
+// serveIPC reads requests until client closes the connection. Requests
+// are handled concurrently, and responses are written once they are
+// done, client matches them by ids.
 func (i *ipcServer) serveIPC(conn net.Conn) {
+	start := time.Now()
 	ctx := context.WithValue(context.Background(),
 		"anser-local", conn.LocalAddr())
+	ctx = context.WithValue(ctx, "anser-transport", TransportIPC)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
+	reader := &messageReader{r: conn}
 	localConn := &ipcServerConn{
-		Reader:                 io.LimitReader(conn, _maxReqContentLength),
+		Reader:                 reader,
 		WriteCloserAndDeadline: conn,
 	}
 
-	jcodec := newCodec(localConn)
+	jcodec := newFormatCodec(localConn, i.format)
+	jcodec.enableNotifier()
 	defer jcodec.close()
 
-	doHandle(ctx, jcodec, i.sr)
+	i.codecs.add(jcodec)
+	defer i.codecs.remove(jcodec)
+
+	ctx, err := i.auth.authenticate(ctx, &AuthInfo{
+		Transport:  TransportIPC,
+		RemoteAddr: conn.RemoteAddr().String(),
+		Conn:       conn,
+		PeerCred:   peerCredOf(conn),
+	})
+	if err != nil {
+		n, _ := jcodec.writeTo(ctx, makeJSONErrorMessage(err))
+		i.sr.accessLogging().logRejected(ctx, remoteAddr(ctx), start, err, n)
+		return
+	}
+
+	idle := newIdleCloser(i.idle, jcodec.close, jcodec.ntf.subscribed)
+	defer idle.stop()
+
+	// responses of requests in handling are written before the
+	// connection is closed
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// connection is kept for subscriptions until client closes it
+	for {
+		reader.reset()
+		msgs, isBatch, err := jcodec.readBatch()
+		if err != nil {
+			// the connection is not read any more, e.g. it is closed or
+			// the content is invalid, so methods in running are cancelled
+			if isParseError(err) {
+				_xlog.Debug("Read message error", "err", err)
+				jcodec.writeTo(ctx, makeJSONErrorMessage(_errInvalidRequest))
+			}
+
+			cancel()
+			return
+		}
+
+		wg.Add(1)
+		idle.begin()
+		go func() {
+			defer wg.Done()
+			defer idle.end()
+
+			handleAndWrite(ctx, jcodec, i.sr, msgs, isBatch)
+		}()
+	}
 }
@@ -0,0 +1,139 @@
+package anserpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPCConcurrentCalls(t *testing.T) {
+	b := &blocker{started: make(chan struct{}, 1), release: make(chan struct{})}
+	sr := newTestRegistry(b)
+	sr.registerWithAPI(&API{Service: "plane", Public: true, Receiver: &plane{}})
+
+	server := newIPCServer(sr, nil, nil, 0)
+	client, conn := net.Pipe()
+	defer client.Close()
+
+	go server.serveIPC(conn)
+
+	dec := json.NewDecoder(client)
+	client.Write([]byte(`{"jsonrpc":"2.0","id":1,"service":"test","method":"block"}`))
+	<-b.started
+
+	// the later request is responded while the first one is blocked
+	client.Write([]byte(`{"jsonrpc":"2.0","id":2,"service":"plane","method":"size","params":["AQI="]}`))
+	var resp jsonMessage
+	if err := dec.Decode(&resp); err != nil || string(resp.ID) != "2" ||
+		string(resp.Result) != "2" {
+		t.Fatalf("response = %+v (%v), want result of 2", resp, err)
+	}
+
+	close(b.release)
+	resp = jsonMessage{}
+	if err := dec.Decode(&resp); err != nil || string(resp.ID) != "1" ||
+		string(resp.Result) != `"released"` {
+		t.Fatalf("response = %+v (%v), want result of 1", resp, err)
+	}
+}
+
+func TestIPCMessageLimit(t *testing.T) {
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{Service: "plane", Public: true, Receiver: &plane{}})
+
+	server := newIPCServer(sr, nil, nil, 0)
+	client, conn := net.Pipe()
+	defer client.Close()
+
+	go server.serveIPC(conn)
+
+	// the limit is of every message, but not the connection
+	param := strings.Repeat("A", _maxReqContentLength/2)
+	req := `{"jsonrpc":"2.0","id":1,"service":"plane","method":"size","params":["` + param + `"]}`
+
+	dec := json.NewDecoder(client)
+	for i := 0; i < 3; i++ {
+		go client.Write([]byte(req))
+
+		var resp jsonMessage
+		if err := dec.Decode(&resp); err != nil || resp.hasErr() {
+			t.Fatalf("response %d = %+v (%v), want result", i, resp, err)
+		}
+	}
+
+	go client.Write([]byte(req[:len(req)-2] + param + `"]}`))
+	var resp jsonMessage
+	if err := dec.Decode(&resp); err != nil || !resp.hasErr() ||
+		resp.Error.Code != _errInvalidRequest.ErrorCode() {
+		t.Errorf("response of large message = %+v (%v), want invalid request", resp, err)
+	}
+}
+
+func TestIPCIdleTimeout(t *testing.T) {
+	b := &blocker{started: make(chan struct{}, 1), release: make(chan struct{})}
+	server := newIPCServer(newTestRegistry(b), nil, nil, 50*time.Millisecond)
+	client, conn := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		server.serveIPC(conn)
+		close(done)
+	}()
+
+	// the connection with a call in handling is not idle
+	client.Write([]byte(`{"jsonrpc":"2.0","id":1,"service":"test","method":"block"}`))
+	<-b.started
+
+	select {
+	case <-done:
+		t.Fatal("connection with a call in handling is closed")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(b.release)
+	var resp jsonMessage
+	if err := json.NewDecoder(client).Decode(&resp); err != nil || resp.hasErr() {
+		t.Fatalf("response = %+v (%v), want result", resp, err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("idle connection is not closed")
+	}
+}
+
+func TestIPCCancelOnClose(t *testing.T) {
+	s := &sleeper{errs: make(chan error, 1)}
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{Service: "sleeper", Public: true, Receiver: s})
+
+	server := newIPCServer(sr, nil, nil, 0)
+	client, conn := net.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		server.serveIPC(conn)
+		close(done)
+	}()
+
+	client.Write([]byte(`{"jsonrpc":"2.0","id":1,"service":"sleeper","method":"wait","params":[5000]}`))
+	time.Sleep(50 * time.Millisecond)
+
+	// methods in running are cancelled once client is gone
+	client.Close()
+	select {
+	case err := <-s.errs:
+		if err != context.Canceled {
+			t.Errorf("ctx error of method = %v, want canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ctx of method is not cancelled")
+	}
+
+	<-done
+}
@@ -1,9 +1,35 @@
 package anserpc
 
 import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
 	"github.com/rcrowley/go-metrics"
 )
 
+// help text of metrics, keyed by name without labels
+var _metricHelps = map[string]string{
+	"anser/requests": "Number of methods called.",
+	"anser/success":  "Number of requests completed successfully.",
+	"anser/failure":  "Number of requests failed, timeouts are not included.",
+	"anser/timeout":  "Number of requests timed out.",
+
+	"anser/method_calls":     "Number of method calls by transport, group, service, version and method.",
+	"anser/method_errors":    "Number of error responses by JSON-RPC error code.",
+	"anser/method_in_flight": "Number of methods in running.",
+	"anser/method_latency":   "Latency of methods until they are responded.",
+}
+
+func metricHelp(name string) string {
+	if help, ok := _metricHelps[name]; ok {
+		return help
+	}
+
+	return "Metric " + name + " of anserpc."
+}
+
 var (
 	_requestCounter = metrics.GetOrRegisterCounter(
 		"anser/requests", nil)
@@ -11,4 +37,134 @@ var (
 		"anser/success", nil)
 	_failureReqeustCounter = metrics.GetOrRegisterCounter(
 		"anser/failure", nil)
+	_timeoutRequestCounter = metrics.GetOrRegisterCounter(
+		"anser/timeout", nil)
+)
+
+// labelled metrics of method, they are cached by labels
+var (
+	_methodMetricsMu sync.Mutex
+	_methodMetrics   = make(map[string]*methodMetrics)
 )
+
+type methodMetrics struct {
+	labels   string
+	calls    metrics.Counter
+	inFlight *inFlightGauge
+	latency  metrics.Timer
+}
+
+// inFlightGauge is increased once method starts, and decreased once it
+// returns.
+type inFlightGauge struct {
+	n int64
+}
+
+func (g *inFlightGauge) Inc(i int64) { atomic.AddInt64(&g.n, i) }
+
+func (g *inFlightGauge) Dec(i int64) { atomic.AddInt64(&g.n, -i) }
+
+func (g *inFlightGauge) value() int64 { return atomic.LoadInt64(&g.n) }
+
+// metricLabels formats pairs of name and value in Prometheus style, e.g.
+// {transport="http",method="ip"}
+func metricLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(pairs[i+1]))
+		b.WriteByte('"')
+	}
+
+	b.WriteByte('}')
+	return b.String()
+}
+
+// methodMetricsOf returns metrics of method, names of them are built by
+// registered services to keep labels bounded.
+func methodMetricsOf(transport, grp, service, version, method string) *methodMetrics {
+	labels := metricLabels("transport", transport, "group", grp,
+		"service", service, "version", version, "method", method)
+
+	_methodMetricsMu.Lock()
+	defer _methodMetricsMu.Unlock()
+
+	if m, ok := _methodMetrics[labels]; ok {
+		return m
+	}
+
+	m := &methodMetrics{
+		labels:   labels,
+		calls:    metrics.GetOrRegisterCounter("anser/method_calls"+labels, nil),
+		inFlight: &inFlightGauge{},
+		latency:  metrics.GetOrRegisterTimer("anser/method_latency"+labels, nil),
+	}
+
+	metrics.GetOrRegister("anser/method_in_flight"+labels,
+		metrics.NewFunctionalGauge(m.inFlight.value))
+	_methodMetrics[labels] = m
+	return m
+}
+
+// unregisterMethodMetrics removes metrics of methods of the service,
+// which is unregistered or replaced by another version, so labels of
+// removed services are not exported forever.
+func unregisterMethodMetrics(e RegistryEvent) {
+	version := e.Version
+	switch {
+	case e.Type == ServiceUnregistered:
+	case e.Type == ServiceReplaced && e.OldVersion != e.Version:
+		version = e.OldVersion
+	default:
+		return
+	}
+
+	srvLabels := metricLabels("group", e.Group, "service", e.Service,
+		"version", version)
+	srvLabels = "," + srvLabels[1:len(srvLabels)-1] + ","
+
+	var errNames []string
+	metrics.DefaultRegistry.Each(func(name string, _ interface{}) {
+		if strings.HasPrefix(name, "anser/method_errors") {
+			errNames = append(errNames, name)
+		}
+	})
+
+	_methodMetricsMu.Lock()
+	defer _methodMetricsMu.Unlock()
+
+	for labels := range _methodMetrics {
+		if !strings.Contains(labels, srvLabels) {
+			continue
+		}
+
+		delete(_methodMetrics, labels)
+		metrics.Unregister("anser/method_calls" + labels)
+		metrics.Unregister("anser/method_in_flight" + labels)
+		metrics.Unregister("anser/method_latency" + labels)
+
+		prefix := "anser/method_errors" + labels[:len(labels)-1] + ",code="
+		for _, name := range errNames {
+			if strings.HasPrefix(name, prefix) {
+				metrics.Unregister(name)
+			}
+		}
+	}
+}
+
+// unresolvedMetrics is used by requests which are not resolved to any
+// method, e.g. invalid request and method not found.
+func unresolvedMetrics(transport string) *methodMetrics {
+	return methodMetricsOf(transport, "", "", "", "")
+}
+
+func (m *methodMetrics) observeError(code int) {
+	labels := m.labels[:len(m.labels)-1] + `,code="` + strconv.Itoa(code) + `"}`
+	metrics.GetOrRegisterCounter("anser/method_errors"+labels, nil).Inc(1)
+}
@@ -0,0 +1,145 @@
+package anserpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+type meter struct{}
+
+func (m *meter) Read() (int, error) { return 1, nil }
+
+func (m *meter) Fail() error { return StatusError{code: -1, err: "failed"} }
+
+func TestMethodMetrics(t *testing.T) {
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{
+		Group:    "system",
+		Service:  "meter",
+		Version:  "1.0",
+		Public:   true,
+		Receiver: &meter{},
+	})
+
+	ctx := context.WithValue(context.Background(), "anser-transport", TransportIPC)
+	for _, req := range []string{
+		`{"jsonrpc":"2.0","id":1,"group":"system","service":"meter","method":"read"}`,
+		`{"jsonrpc":"2.0","id":2,"group":"System","service":"meter","method":"READ"}`,
+		`{"jsonrpc":"2.0","id":3,"group":"system","service":"meter","method":"fail"}`,
+		`{"jsonrpc":"2.0","id":4,"group":"system","service":"meter","method":"unknown"}`,
+	} {
+		conn := &testConn{Reader: strings.NewReader(req)}
+		jcodec := newCodec(conn)
+		doHandle(ctx, jcodec, sr)
+		jcodec.close()
+	}
+
+	labels := func(method string) string {
+		return metricLabels("transport", "ipc", "group", "system",
+			"service", "meter", "version", "1.0", "method", method)
+	}
+
+	counter := func(name string) int64 {
+		if c, ok := metrics.Get(name).(metrics.Counter); ok {
+			return c.Count()
+		}
+
+		return -1
+	}
+
+	if n := counter("anser/method_calls" + labels("read")); n != 2 {
+		t.Errorf("calls of read = %d, want 2", n)
+	}
+
+	if n := counter(`anser/method_errors{transport="ipc",group="system",service="meter",` +
+		`version="1.0",method="fail",code="-1"}`); n != 1 {
+		t.Errorf("errors of fail = %d, want 1", n)
+	}
+
+	// method not found is not labelled by the requested method
+	if n := counter(`anser/method_errors{transport="ipc",group="",service="",` +
+		`version="",method="",code="-32601"}`); n < 1 {
+		t.Errorf("errors of unresolved requests = %d, want 1", n)
+	}
+
+	if timer, ok := metrics.Get("anser/method_latency" + labels("read")).(metrics.Timer); !ok ||
+		timer.Count() != 2 {
+		t.Errorf("latency of read is not recorded")
+	}
+
+	if gauge, ok := metrics.Get("anser/method_in_flight" + labels("read")).(metrics.Gauge); !ok ||
+		gauge.Value() != 0 {
+		t.Errorf("in-flight of read is not 0")
+	}
+
+	// exported by the built-in method and Prometheus
+	resp := serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"service":"built-in","method":"metrics"}`)
+	var all string
+	if err := json.Unmarshal(resp.Result, &all); err != nil ||
+		!strings.Contains(all, "anser/method_calls") {
+		t.Errorf("built-in metrics = %s, want method calls", resp.Result)
+	}
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, metrics.DefaultRegistry)
+	if !strings.Contains(buf.String(), "anser_method_calls_total"+labels("read")+" 2") {
+		t.Errorf("prometheus output has no calls of read:\n%s", buf.String())
+	}
+}
+
+func TestMetricLabelsEscaped(t *testing.T) {
+	got := metricLabels("method", "a\\b\"c\nd\té")
+	if want := `{method="a\\b\"c\nd` + "\té" + `"}`; got != want {
+		t.Errorf("labels = %s, want %s", got, want)
+	}
+}
+
+func TestUnregisterMethodMetrics(t *testing.T) {
+	sr := newServiceRegistry()
+	for _, version := range []string{"1.0", "2.0"} {
+		sr.registerWithAPI(&API{
+			Group:    "gone",
+			Service:  "meter",
+			Version:  version,
+			Public:   true,
+			Receiver: &meter{},
+		})
+	}
+
+	for _, req := range []string{
+		`{"jsonrpc":"2.0","id":1,"group":"gone","service":"meter","service_version":"1.0","method":"read"}`,
+		`{"jsonrpc":"2.0","id":2,"group":"gone","service":"meter","service_version":"1.0","method":"fail"}`,
+		`{"jsonrpc":"2.0","id":3,"group":"gone","service":"meter","service_version":"2.0","method":"read"}`,
+	} {
+		serveAs(t, sr, nil, req)
+	}
+
+	labels := func(version, method string) string {
+		return metricLabels("transport", "", "group", "gone",
+			"service", "meter", "version", version, "method", method)
+	}
+
+	if err := sr.unregister("gone", "meter", "1.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{
+		"anser/method_calls" + labels("1.0", "read"),
+		"anser/method_latency" + labels("1.0", "read"),
+		"anser/method_in_flight" + labels("1.0", "read"),
+		"anser/method_errors" + strings.TrimSuffix(labels("1.0", "fail"), "}") + `,code="-1"}`,
+	} {
+		if metrics.Get(name) != nil {
+			t.Errorf("%s is not unregistered", name)
+		}
+	}
+
+	if metrics.Get("anser/method_calls"+labels("2.0", "read")) == nil {
+		t.Error("metrics of another version are unregistered")
+	}
+}
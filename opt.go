@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/chao77977/anserpc/util"
 )
@@ -23,11 +24,20 @@ type Option interface {
 }
 
 type options struct {
-	rpc    *rpcEndpoint
-	ipc    ipcEndpoint
-	log    *logOpt
-	http   *httpOpt
-	intrpt *interruptOpt
+	rpc          *rpcEndpoint
+	ipc          ipcEndpoint
+	ipcFormat    *wireFormat
+	ipcIdle      time.Duration
+	log          *logOpt
+	http         *httpOpt
+	intrpt       *interruptOpt
+	interceptors []Interceptor
+	auth         authOpt
+	policy       *Policy
+	timeout      time.Duration
+	rateLimits   []*rateLimitOpt
+	tracer       *tracer
+	accessLog    *accessLogger
 }
 
 func defaultOpt() *options {
@@ -61,6 +71,29 @@ func WithDefaultRPCEndpoint() Option {
 	return WithRPCEndpoint(_defRPCHost, _defRPCPort)
 }
 
+type ipcFormatOpt Format
+
+func (i ipcFormatOpt) apply(opts *options) {
+	opts.ipcFormat = formatOf(Format(i))
+}
+
+// WithIPCFormatOpt sets format of messages on IPC, it is JSON by default.
+func WithIPCFormatOpt(format Format) Option {
+	return ipcFormatOpt(format)
+}
+
+type ipcIdleOpt time.Duration
+
+func (i ipcIdleOpt) apply(opts *options) {
+	opts.ipcIdle = time.Duration(i)
+}
+
+// WithIPCIdleTimeoutOpt closes IPC connections which have no calls in
+// handling, nor subscriptions, for timeout. They are kept by default.
+func WithIPCIdleTimeoutOpt(timeout time.Duration) Option {
+	return ipcIdleOpt(timeout)
+}
+
 type ipcEndpoint string
 
 func (i ipcEndpoint) apply(opts *options) {
@@ -129,6 +162,9 @@ func withDefaultHTTPOpt() *httpOpt {
 		_defAppJson,
 		_defAppJsonRpc,
 		_defAppJsonReq,
+		_defAppMsgpack,
+		_defAppXMsgpack,
+		_defAppCBOR,
 	})
 
 	return &httpOpt{
@@ -136,6 +172,7 @@ func withDefaultHTTPOpt() *httpOpt {
 		deniedMethods:       deniedMethods,
 		allowedContentTypes: allowedContentTypes,
 		WebsocketAllowed:    true,
+		websocketInFlight:   _defWebsocketInFlight,
 	}
 }
 
@@ -176,6 +213,27 @@ func WithHTTPDeniedMethodOpt(methods ...string) Option {
 	return opt
 }
 
+// WithHTTPMetricsOpt serves metrics in Prometheus text format on path of
+// HTTP server, it is "/metrics" if path is empty.
+func WithHTTPMetricsOpt(path string) Option {
+	if path == "" {
+		path = _defMetricsPath
+	}
+
+	return &httpOpt{
+		metricsPath: path,
+	}
+}
+
+// WithWebsocketInFlightOpt limits requests in handling on a Websocket
+// connection, reading of the connection waits once it is reached. It is
+// 16 by default.
+func WithWebsocketInFlightOpt(n int) Option {
+	return &httpOpt{
+		websocketInFlight: n,
+	}
+}
+
 type interruptOpt struct {
 	disableInterruptHandler bool
 }
@@ -189,3 +247,15 @@ func WithDisableInterruptHandler() Option {
 		disableInterruptHandler: true,
 	}
 }
+
+type timeoutOpt time.Duration
+
+func (t timeoutOpt) apply(opts *options) {
+	opts.timeout = time.Duration(t)
+}
+
+// WithTimeoutOpt sets the global timeout of methods, ctx of method is
+// cancelled once it is timeout. It is 1 hour by default.
+func WithTimeoutOpt(timeout time.Duration) Option {
+	return timeoutOpt(timeout)
+}
@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package anserpc
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredOf returns credentials of the peer of unix socket, it is nil
+// for other connections, e.g. net.Pipe.
+func peerCredOf(conn net.Conn) *PeerCred {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	var (
+		cred    *syscall.Ucred
+		credErr error
+	)
+
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET,
+			syscall.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		return nil
+	}
+
+	return &PeerCred{
+		Pid: cred.Pid,
+		Uid: cred.Uid,
+		Gid: cred.Gid,
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package anserpc
+
+import "net"
+
+// peerCredOf returns nil, SO_PEERCRED is only supported on Linux
+func peerCredOf(conn net.Conn) *PeerCred {
+	return nil
+}
@@ -0,0 +1,109 @@
+package anserpc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/chao77977/anserpc/util"
+)
+
+// Policy declares the roles(or scopes) required by groups, services and
+// methods, the principal must have one of them. Services are keyed by
+// fingerprint with its group, methods by service key and method name:
+//
+//	{
+//	  "groups":   {"system": ["operator"]},
+//	  "services": {"system/network_1.0": ["admin"], "echo_1.0": []},
+//	  "methods":  {"system/network_1.0.ip": ["*"]}
+//	}
+//
+// The most specific rule is applied. An empty list allows everyone, and
+// "*" allows any authenticated principal. Services not matched by any
+// rule are only available if they are public, authenticated principals
+// are denied, and they are not found by anonymous callers.
+type Policy struct {
+	Groups   map[string][]string `json:"groups,omitempty"`
+	Services map[string][]string `json:"services,omitempty"`
+	Methods  map[string][]string `json:"methods,omitempty"`
+}
+
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func formatRules(rules map[string][]string) map[string][]string {
+	formatted := make(map[string][]string, len(rules))
+	for key, roles := range rules {
+		formatted[util.FormatName(key)] = roles
+	}
+
+	return formatted
+}
+
+// rules returns a copy of policy with names formatted
+func (p *Policy) rules() *Policy {
+	return &Policy{
+		Groups:   formatRules(p.Groups),
+		Services: formatRules(p.Services),
+		Methods:  formatRules(p.Methods),
+	}
+}
+
+// roles returns roles of the most specific rule, ok is false if no rule
+// is matched.
+func (p *Policy) roles(grpName string, fingerprint []byte, method string) (roles []string, ok bool) {
+	if p == nil {
+		return nil, false
+	}
+
+	srvKey := string(fingerprint)
+	if grpName != "" {
+		srvKey = grpName + "/" + srvKey
+	}
+
+	if roles, ok = p.Methods[srvKey+"."+method]; ok {
+		return
+	}
+
+	if roles, ok = p.Services[srvKey]; ok {
+		return
+	}
+
+	roles, ok = p.Groups[grpName]
+	return
+}
+
+func (p *Principal) hasAnyRole(roles []string) bool {
+	for _, role := range roles {
+		if role == "*" || p.HasRole(role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type policyOpt struct {
+	policy *Policy
+}
+
+func (p *policyOpt) apply(opts *options) {
+	opts.policy = p.policy
+}
+
+// WithPolicyOpt enables access control of services, see Policy.
+func WithPolicyOpt(policy *Policy) Option {
+	return &policyOpt{
+		policy: policy,
+	}
+}
@@ -0,0 +1,169 @@
+package anserpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type ops struct{}
+
+func (o *ops) Status() (string, error)  { return "ok", nil }
+func (o *ops) Restart() (string, error) { return "restarted", nil }
+
+type profile struct{}
+
+func (p *profile) Name() (string, error) { return "anser", nil }
+
+func newPolicyRegistry(policy *Policy) *serviceRegistry {
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{
+		Group:    "system",
+		Service:  "ops",
+		Version:  "1.0",
+		Receiver: &ops{},
+	})
+	sr.registerWithAPI(&API{
+		Service:  "profile",
+		Version:  "1.0",
+		Public:   true,
+		Receiver: &profile{},
+	})
+
+	sr.setPolicy(policy)
+	return sr
+}
+
+func serveAs(t *testing.T, sr *serviceRegistry, p *Principal, req string) *jsonMessage {
+	t.Helper()
+
+	ctx := context.Background()
+	if p != nil {
+		ctx = context.WithValue(ctx, "anser-principal", p)
+	}
+
+	conn := &testConn{Reader: strings.NewReader(req)}
+	jcodec := newCodec(conn)
+	defer jcodec.close()
+
+	doHandle(ctx, jcodec, sr)
+
+	var resp jsonMessage
+	if err := json.Unmarshal(conn.out.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", conn.out.String(), err)
+	}
+
+	return &resp
+}
+
+func TestPolicy(t *testing.T) {
+	sr := newPolicyRegistry(&Policy{
+		Groups:   map[string][]string{"System": {"operator"}},
+		Services: map[string][]string{"profile_1.0": {"*"}},
+		Methods:  map[string][]string{"system/ops_1.0.restart": {"admin"}},
+	})
+
+	status := `{"jsonrpc":"2.0","id":1,"group":"system","service":"ops","service_version":"1.0","method":"status"}`
+	restart := `{"jsonrpc":"2.0","id":1,"group":"system","service":"ops","service_version":"1.0","method":"restart"}`
+	name := `{"jsonrpc":"2.0","id":1,"service":"profile","service_version":"1.0","method":"name"}`
+
+	operator := &Principal{Name: "op", Roles: []string{"operator"}}
+	admin := &Principal{Name: "root", Roles: []string{"admin"}}
+
+	for _, c := range []struct {
+		p    *Principal
+		req  string
+		code int
+	}{
+		// service is not public, but allowed by policy
+		{operator, status, 0},
+		{operator, restart, _errPermissionDenied.ErrorCode()},
+		{admin, status, _errPermissionDenied.ErrorCode()},
+		{admin, restart, 0},
+		{nil, status, _errPermissionDenied.ErrorCode()},
+		{nil, name, _errPermissionDenied.ErrorCode()},
+		{operator, name, 0},
+	} {
+		resp := serveAs(t, sr, c.p, c.req)
+		code := 0
+		if resp.hasErr() {
+			code = resp.Error.Code
+		}
+
+		if code != c.code {
+			t.Errorf("%v: %s = %+v, want code %d", c.p, c.req, resp, c.code)
+		}
+	}
+}
+
+func TestPolicyNotMatched(t *testing.T) {
+	sr := newPolicyRegistry(&Policy{
+		Services: map[string][]string{"system/ops_1.0": {}},
+	})
+
+	resp := serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"group":"system",`+
+		`"service":"ops","service_version":"1.0","method":"status"}`)
+	if resp.hasErr() {
+		t.Errorf("response = %+v, want allowed by empty roles", resp)
+	}
+
+	// service, which is not public and not matched, is denied to
+	// authenticated callers, and not found by the others
+	sr.setPolicy(&Policy{})
+	for _, c := range []struct {
+		p    *Principal
+		code int
+	}{
+		{&Principal{Name: "root", Roles: []string{"admin"}}, _errPermissionDenied.ErrorCode()},
+		{nil, _errMethodNotFound.ErrorCode()},
+	} {
+		resp = serveAs(t, sr, c.p, `{"jsonrpc":"2.0","id":1,"group":"system",`+
+			`"service":"ops","service_version":"1.0","method":"status"}`)
+		if !resp.hasErr() || resp.Error.Code != c.code {
+			t.Errorf("response of %v = %+v, want code %d", c.p, resp, c.code)
+		}
+	}
+
+	// without policy, it is not found as before
+	sr.setPolicy(nil)
+	resp = serveAs(t, sr, &Principal{Name: "root", Roles: []string{"admin"}},
+		`{"jsonrpc":"2.0","id":1,"group":"system","service":"ops","service_version":"1.0","method":"status"}`)
+	if !resp.hasErr() || resp.Error.Code != _errMethodNotFound.ErrorCode() {
+		t.Errorf("response = %+v, want method not found", resp)
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anserpc-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(path, []byte(`{
+		"groups": {"system": ["operator"]},
+		"methods": {"system/ops_1.0.restart": ["admin"]}
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if roles, ok := p.roles("system", []byte("ops_1.0"), "restart"); !ok ||
+		len(roles) != 1 || roles[0] != "admin" {
+		t.Errorf("roles of restart = %v, want [admin]", roles)
+	}
+
+	if roles, ok := p.roles("system", []byte("ops_1.0"), "status"); !ok ||
+		len(roles) != 1 || roles[0] != "operator" {
+		t.Errorf("roles of status = %v, want [operator]", roles)
+	}
+}
@@ -0,0 +1,173 @@
+package anserpc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	_defMetricsPath     = "/metrics"
+	_prometheusTextType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	_quantiles = []float64{0.5, 0.9, 0.99}
+
+	// only backslash, double-quote and line feed are escaped in label
+	// values of the text format
+	_labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func escapeLabelValue(v string) string {
+	return _labelValueEscaper.Replace(v)
+}
+
+// metricsHandler renders the metrics registry in Prometheus text format
+// on path, other requests are passed to next.
+type metricsHandler struct {
+	path     string
+	registry metrics.Registry
+	next     http.Handler
+}
+
+func (m *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.path == "" || r.URL.Path != m.path {
+		m.next.ServeHTTP(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("content-type", _prometheusTextType)
+	writePrometheus(w, m.registry)
+}
+
+func newMetricsHandler(opt *httpOpt, next http.Handler) http.Handler {
+	return &metricsHandler{
+		path:     opt.metricsPath,
+		registry: metrics.DefaultRegistry,
+		next:     next,
+	}
+}
+
+// metricFamily is metrics of the same name with different labels
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []string
+}
+
+func (f *metricFamily) add(suffix, labels string, value float64) {
+	f.samples = append(f.samples, f.name+suffix+labels+" "+
+		strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// splitMetricName splits name into base name and labels, e.g.
+// anser/calls{method="ip"}
+func splitMetricName(name string) (string, string) {
+	if i := strings.IndexByte(name, '{'); i >= 0 && strings.HasSuffix(name, "}") {
+		return name[:i], name[i:]
+	}
+
+	return name, ""
+}
+
+func prometheusName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' ||
+			c == ':' || c >= '0' && c <= '9' && i > 0) {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+// withQuantile adds label quantile to labels
+func withQuantile(labels string, q float64) string {
+	quantile := `quantile="` + strconv.FormatFloat(q, 'g', -1, 64) + `"`
+	if labels == "" {
+		return "{" + quantile + "}"
+	}
+
+	return labels[:len(labels)-1] + "," + quantile + "}"
+}
+
+func writePrometheus(out io.Writer, r metrics.Registry) error {
+	families := make(map[string]*metricFamily)
+	family := func(base, suffix, typ string) *metricFamily {
+		name := prometheusName(base) + suffix
+		f, ok := families[name]
+		if !ok {
+			f = &metricFamily{name: name, help: metricHelp(base), typ: typ}
+			families[name] = f
+		}
+
+		return f
+	}
+
+	summary := func(base, unit, labels string, count int64, sum float64, ps []float64, scale float64) {
+		f := family(base, unit, "summary")
+		for i, q := range _quantiles {
+			f.add("", withQuantile(labels, q), ps[i]/scale)
+		}
+
+		f.add("_sum", labels, sum/scale)
+		f.add("_count", labels, float64(count))
+	}
+
+	r.Each(func(name string, i interface{}) {
+		base, labels := splitMetricName(name)
+		switch m := i.(type) {
+		case metrics.Counter:
+			family(base, "_total", "counter").add("", labels, float64(m.Count()))
+		case metrics.Gauge:
+			family(base, "", "gauge").add("", labels, float64(m.Value()))
+		case metrics.GaugeFloat64:
+			family(base, "", "gauge").add("", labels, m.Value())
+		case metrics.Meter:
+			family(base, "_total", "counter").add("", labels, float64(m.Count()))
+		case metrics.Histogram:
+			s := m.Snapshot()
+			summary(base, "", labels, s.Count(), float64(s.Sum()),
+				s.Percentiles(_quantiles), 1)
+		case metrics.Timer:
+			// nanoseconds are exported as seconds
+			s := m.Snapshot()
+			summary(base, "_seconds", labels, s.Count(), float64(s.Sum()),
+				s.Percentiles(_quantiles), 1e9)
+		}
+	})
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	w := bufio.NewWriter(out)
+	for _, name := range names {
+		f := families[name]
+		sort.Strings(f.samples)
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+		for _, sample := range f.samples {
+			w.WriteString(sample)
+			w.WriteByte('\n')
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,83 @@
+package anserpc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("anser/requests", r).Inc(3)
+	metrics.GetOrRegisterCounter(`anser/calls{method="ip"}`, r).Inc(2)
+	metrics.GetOrRegisterCounter(`anser/calls{method="add"}`, r).Inc(1)
+	metrics.GetOrRegisterGauge("anser/in-flight", r).Update(4)
+
+	timer := metrics.GetOrRegisterTimer(`anser/latency{method="ip"}`, r)
+	timer.Update(2 * time.Second)
+
+	var buf bytes.Buffer
+	if err := writePrometheus(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP anser_calls_total Metric anser/calls of anserpc.
+# TYPE anser_calls_total counter
+anser_calls_total{method="add"} 1
+anser_calls_total{method="ip"} 2
+# HELP anser_in_flight Metric anser/in-flight of anserpc.
+# TYPE anser_in_flight gauge
+anser_in_flight 4
+# HELP anser_latency_seconds Metric anser/latency of anserpc.
+# TYPE anser_latency_seconds summary
+anser_latency_seconds_count{method="ip"} 1
+anser_latency_seconds_sum{method="ip"} 2
+anser_latency_seconds{method="ip",quantile="0.5"} 2
+anser_latency_seconds{method="ip",quantile="0.9"} 2
+anser_latency_seconds{method="ip",quantile="0.99"} 2
+# HELP anser_requests_total Number of methods called.
+# TYPE anser_requests_total counter
+anser_requests_total 3
+`
+	if buf.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestMetricsPath(t *testing.T) {
+	opts := &options{http: withDefaultHTTPOpt()}
+	WithHTTPMetricsOpt("").apply(opts)
+
+	ts := httptest.NewServer(newHttpServer(opts.http, newTestRegistry(&counter{}), nil).head)
+	defer ts.Close()
+
+	// content type is not checked
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("content-type") != _prometheusTextType ||
+		!strings.Contains(string(body), "# TYPE anser_requests_total counter") {
+		t.Errorf("metrics = %d %s, want prometheus text", resp.StatusCode, body)
+	}
+
+	resp, err = http.Post(ts.URL+"/metrics", _defAppJson, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST metrics = %d, want 405", resp.StatusCode)
+	}
+}
@@ -0,0 +1,202 @@
+package anserpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chao77977/anserpc/util"
+)
+
+const (
+	_rateLimitSweepInterval = time.Minute
+)
+
+// RateLimitKey is what requests are limited by
+type RateLimitKey int
+
+const (
+	// host of remote address, IPC clients share the same limit
+	RateLimitByRemote RateLimitKey = iota
+	// name of the authenticated principal, or host of remote address if
+	// it is not authenticated
+	RateLimitByPrincipal
+	// group, service with the resolved version and method of request
+	RateLimitByMethod
+)
+
+type rateLimitOpt struct {
+	key   RateLimitKey
+	rate  float64
+	burst int
+}
+
+func (r *rateLimitOpt) apply(opts *options) {
+	opts.rateLimits = append(opts.rateLimits, r)
+}
+
+// WithRateLimitOpt limits requests of each key to rate per second with
+// burst(token bucket), requests over the limit are rejected with error
+// "rate limited", and HTTP status 429.
+func WithRateLimitOpt(key RateLimitKey, rate float64, burst int) Option {
+	return &rateLimitOpt{
+		key:   key,
+		rate:  rate,
+		burst: burst,
+	}
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	key     RateLimitKey
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newRateLimiter(opt *rateLimitOpt) *rateLimiter {
+	burst := opt.burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		key:     opt.key,
+		rate:    opt.rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		swept:   time.Now(),
+	}
+}
+
+// keyOf returns key of request, names are formatted so that requests of
+// the same method share the bucket.
+func (r *rateLimiter) keyOf(ctx context.Context, req *Request, srv *service) string {
+	switch r.key {
+	case RateLimitByPrincipal:
+		if p, ok := PrincipalFromContext(ctx); ok {
+			return "principal:" + p.Name
+		}
+	case RateLimitByMethod:
+		key := string(srv.fingerprint()) + "." + util.FormatName(req.Method)
+		if grp := util.FormatName(req.Group); grp != "" {
+			key = grp + "/" + key
+		}
+
+		return key
+	}
+
+	return "remote:" + remoteHost(ctx)
+}
+
+// take takes a token of key, it returns false if the bucket is empty
+func (r *rateLimiter) take(key string) bool {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now)
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: r.burst, last: now}
+		r.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * r.rate
+	if b.tokens > r.burst {
+		b.tokens = r.burst
+	}
+
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// giveBack returns the token of key, which is taken by the request
+// rejected by other limits.
+func (r *rateLimiter) giveBack(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.buckets[key]; ok && b.tokens+1 <= r.burst {
+		b.tokens++
+	}
+}
+
+// sweep removes buckets which are full again, they are the same as new
+// ones.
+func (r *rateLimiter) sweep(now time.Time) {
+	if now.Sub(r.swept) < _rateLimitSweepInterval {
+		return
+	}
+
+	r.swept = now
+	for key, b := range r.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*r.rate >= r.burst {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// remoteHost returns host of client, it is "local" on IPC
+func remoteHost(ctx context.Context) string {
+	var addr string
+	if remote, ok := ctx.Value("anser-remote").(string); ok {
+		addr = remote
+	} else if remote, ok := ctx.Value("anser-websocket-remote").(net.Addr); ok {
+		addr = remote.String()
+	} else {
+		return "local"
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// semaphore limits in-flight methods of service
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+
+	return make(semaphore, n)
+}
+
+// tryAcquire returns false if the limit is reached, nil semaphore is
+// unlimited.
+func (s semaphore) tryAcquire() bool {
+	if s == nil {
+		return true
+	}
+
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
@@ -0,0 +1,166 @@
+package anserpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(&rateLimitOpt{key: RateLimitByRemote, rate: 0.001, burst: 2})
+
+	alice := l.keyOf(context.WithValue(context.Background(), "anser-remote", "10.0.0.1:4001"), nil, nil)
+	for i, want := range []bool{true, true, false} {
+		if got := l.take(alice); got != want {
+			t.Errorf("request %d allowed = %v, want %v", i, got, want)
+		}
+	}
+
+	// the same host with another port
+	alice = l.keyOf(context.WithValue(context.Background(), "anser-remote", "10.0.0.1:4002"), nil, nil)
+	if l.take(alice) {
+		t.Error("request of the same host is allowed")
+	}
+
+	bob := l.keyOf(context.WithValue(context.Background(), "anser-remote", "10.0.0.2:4001"), nil, nil)
+	if !l.take(bob) {
+		t.Error("request of another host is not allowed")
+	}
+
+	// the token is given back once
+	l.giveBack(alice)
+	l.giveBack(alice)
+	if !l.take(alice) || l.take(alice) {
+		t.Error("token is not given back")
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	remote := context.WithValue(context.Background(), "anser-remote", "10.0.0.1:4001")
+	principal := context.WithValue(remote, "anser-principal", &Principal{Name: "alice"})
+	req := &Request{Group: "System", Service: "NETWORK", Method: "IP"}
+	srv := &service{name: "network", version: "1.0"}
+
+	for _, c := range []struct {
+		key  RateLimitKey
+		ctx  context.Context
+		want string
+	}{
+		{RateLimitByRemote, principal, "remote:10.0.0.1"},
+		{RateLimitByRemote, context.Background(), "remote:local"},
+		{RateLimitByPrincipal, principal, "principal:alice"},
+		{RateLimitByPrincipal, remote, "remote:10.0.0.1"},
+		{RateLimitByMethod, remote, "system/network_1.0.ip"},
+	} {
+		l := newRateLimiter(&rateLimitOpt{key: c.key, rate: 1, burst: 1})
+		if got := l.keyOf(c.ctx, req, srv); got != c.want {
+			t.Errorf("key %d = %s, want %s", c.key, got, c.want)
+		}
+	}
+}
+
+func TestRateLimitsAllOrNothing(t *testing.T) {
+	sr := newTestRegistry(&requestIDEcho{})
+	sr.setRateLimits(
+		&rateLimitOpt{key: RateLimitByMethod, rate: 0.001, burst: 2},
+		&rateLimitOpt{key: RateLimitByPrincipal, rate: 0.001, burst: 1},
+	)
+
+	req := func(p *Principal, method string) *jsonMessage {
+		return serveAs(t, sr, p, `{"jsonrpc":"2.0","id":1,"service":"test","method":"`+method+`"}`)
+	}
+
+	alice, bob := &Principal{Name: "alice"}, &Principal{Name: "bob"}
+	if resp := req(alice, "id"); resp.hasErr() {
+		t.Fatalf("response = %+v, want allowed", resp)
+	}
+
+	// rejected by the limit of principal, the token of method is not spent
+	if resp := req(alice, "ID"); !resp.hasErr() || resp.Error.Code != _errRateLimited.ErrorCode() {
+		t.Fatalf("response = %+v, want rate limited", resp)
+	}
+
+	if resp := req(bob, "Id"); resp.hasErr() {
+		t.Errorf("response = %+v, want allowed by the last token of method", resp)
+	}
+
+	if resp := req(&Principal{Name: "carol"}, "id"); !resp.hasErr() {
+		t.Errorf("response = %+v, want rate limited by method", resp)
+	}
+}
+
+type blocker struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blocker) Block() (string, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return "released", nil
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	b := &blocker{started: make(chan struct{}, 1), release: make(chan struct{})}
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{
+		Service:        "blocker",
+		Public:         true,
+		Receiver:       b,
+		MaxConcurrency: 1,
+	})
+
+	req := `{"jsonrpc":"2.0","id":1,"service":"blocker","method":"block"}`
+	first := make(chan *jsonMessage)
+	go func() {
+		first <- serveAs(t, sr, nil, req)
+	}()
+	<-b.started
+
+	resp := serveAs(t, sr, nil, req)
+	if !resp.hasErr() || resp.Error.Code != _errRateLimited.ErrorCode() {
+		t.Errorf("response = %+v, want rate limited", resp)
+	}
+
+	close(b.release)
+	if resp := <-first; resp.hasErr() {
+		t.Errorf("first response = %+v, want released", resp)
+	}
+
+	// the limit is released once the method is completed
+	if resp := serveAs(t, sr, nil, req); resp.hasErr() {
+		t.Errorf("response = %+v, want released", resp)
+	}
+}
+
+func TestRateLimitHTTPStatus(t *testing.T) {
+	sr := newTestRegistry(&counter{})
+	sr.setRateLimits(&rateLimitOpt{key: RateLimitByMethod, rate: 0.001, burst: 1})
+
+	ts := httptest.NewServer(newHttpServer(withDefaultHTTPOpt(), sr, nil).head)
+	defer ts.Close()
+
+	post := func() (int, string) {
+		resp, err := http.Post(ts.URL, _defAppJson, strings.NewReader(
+			`{"jsonrpc":"2.0","id":1,"service":"test","method":"add","params":[1,2]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := post(); code != http.StatusOK {
+		t.Errorf("first request = %d %s, want 200", code, body)
+	}
+
+	if code, body := post(); code != http.StatusTooManyRequests ||
+		!strings.Contains(body, `"code":-32017`) {
+		t.Errorf("second request = %d %s, want 429 rate limited", code, body)
+	}
+}
@@ -0,0 +1,124 @@
+package anserpc
+
+import (
+	"fmt"
+
+	"github.com/chao77977/anserpc/util"
+)
+
+type RegistryEventType int
+
+const (
+	ServiceRegistered RegistryEventType = iota + 1
+	ServiceUnregistered
+	ServiceReplaced
+)
+
+func (r RegistryEventType) String() string {
+	switch r {
+	case ServiceRegistered:
+		return "registered"
+	case ServiceUnregistered:
+		return "unregistered"
+	case ServiceReplaced:
+		return "replaced"
+	}
+
+	return "unknown"
+}
+
+// RegistryEvent is a change of registered services, names are formatted
+// as they are resolved.
+type RegistryEvent struct {
+	Type    RegistryEventType
+	Group   string
+	Service string
+	Version string
+	// version of the replaced service, it is the same as Version if the
+	// service is registered again
+	OldVersion string
+}
+
+// observe calls fn on every change of services in order, fn must not
+// change services.
+func (s *serviceRegistry) observe(fn func(RegistryEvent)) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	s.observers = append(s.observers, fn)
+}
+
+// notify is called with changeMu held
+func (s *serviceRegistry) notify(e RegistryEvent) {
+	_xlog.Info("Service "+e.Type.String(), "group", e.Group,
+		"service", e.Service, "service version", e.Version)
+
+	for _, fn := range s.observers {
+		fn(e)
+	}
+}
+
+// unregister removes service of version, calls in running are completed
+// by the removed service.
+func (s *serviceRegistry) unregister(grpName, srvName, version string) error {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	grpName, srvName = util.FormatName(grpName), util.FormatName(srvName)
+	fingerprint := service{name: srvName, version: version}.fingerprint()
+
+	s.mu.Lock()
+	var removed *service
+	if grp, ok := s.groups[grpName]; ok {
+		removed = grp.remove(fingerprint)
+	}
+	s.mu.Unlock()
+
+	if removed == nil {
+		return _errServiceNotFound
+	}
+
+	s.notify(RegistryEvent{Type: ServiceUnregistered, Group: grpName,
+		Service: srvName, Version: version})
+	return nil
+}
+
+// replace removes service of oldVersion and registers api at once, so
+// requests see either of them. The version of api must not be registered
+// unless it is oldVersion.
+func (s *serviceRegistry) replace(oldVersion string, api *API) error {
+	if api == nil {
+		return _errServiceNotFound
+	}
+
+	srv, err := makeService(api)
+	if err != nil {
+		return err
+	}
+
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	grpName := util.FormatName(api.Group)
+	fingerprint := service{name: srv.name, version: oldVersion}.fingerprint()
+
+	s.mu.Lock()
+	grp, ok := s.groups[grpName]
+	if !ok || !grp.contains(fingerprint) {
+		s.mu.Unlock()
+		return _errServiceNotFound
+	}
+
+	if srv.version != oldVersion && grp.contains(srv.fingerprint()) {
+		s.mu.Unlock()
+		return fmt.Errorf("service %s is already registered", srv.fingerprint())
+	}
+
+	grp.remove(fingerprint)
+	grp.add(srv)
+	s.mu.Unlock()
+
+	s.notify(RegistryEvent{Type: ServiceReplaced, Group: grpName,
+		Service: srv.name, Version: srv.version, OldVersion: oldVersion})
+	return nil
+}
@@ -0,0 +1,150 @@
+package anserpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type named struct {
+	name    string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (n *named) Name() (string, error) {
+	if n.started != nil {
+		n.started <- struct{}{}
+		<-n.release
+	}
+
+	return n.name, nil
+}
+
+func TestRegistryReplace(t *testing.T) {
+	sr := newServiceRegistry()
+	var events []RegistryEvent
+	sr.observe(func(e RegistryEvent) {
+		events = append(events, e)
+	})
+
+	old := &named{name: "old", started: make(chan struct{}, 1), release: make(chan struct{})}
+	sr.registerWithAPI(&API{Group: "g", Service: "Named", Version: "1.0", Public: true, Receiver: old})
+
+	req := `{"jsonrpc":"2.0","id":1,"group":"g","service":"named","method":"name"}`
+	first := make(chan *jsonMessage)
+	go func() {
+		first <- serveAs(t, sr, nil, req)
+	}()
+	<-old.started
+
+	if err := sr.replace("1.0", &API{Group: "g", Service: "named", Version: "1.1",
+		Public: true, Receiver: &named{name: "new"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// new calls are served by the new service, and the call in running
+	// is completed by the old one
+	if resp := serveAs(t, sr, nil, req); string(resp.Result) != `"new"` {
+		t.Errorf("response = %+v, want new", resp)
+	}
+
+	close(old.release)
+	if resp := <-first; string(resp.Result) != `"old"` {
+		t.Errorf("response of call in running = %+v, want old", resp)
+	}
+
+	resp := serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"group":"g","service":"named",`+
+		`"service_version":"1.0","method":"name"}`)
+	if !resp.hasErr() || resp.Error.Code != _errVersionNotFound.ErrorCode() {
+		t.Errorf("response of replaced version = %+v, want version not found", resp)
+	}
+
+	if err := sr.unregister("G", "Named", "1.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := serveAs(t, sr, nil, req); !resp.hasErr() ||
+		resp.Error.Code != _errMethodNotFound.ErrorCode() {
+		t.Errorf("response of unregistered service = %+v, want method not found", resp)
+	}
+
+	if err := sr.unregister("g", "named", "1.1"); err != _errServiceNotFound {
+		t.Errorf("unregister again = %v, want service not found", err)
+	}
+
+	want := []RegistryEvent{
+		{Type: ServiceRegistered, Group: "g", Service: "named", Version: "1.0"},
+		{Type: ServiceReplaced, Group: "g", Service: "named", Version: "1.1", OldVersion: "1.0"},
+		{Type: ServiceUnregistered, Group: "g", Service: "named", Version: "1.1"},
+	}
+
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
+
+func TestRegistryReplaceConflict(t *testing.T) {
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{Service: "named", Version: "1.0", Public: true, Receiver: &named{}})
+	sr.registerWithAPI(&API{Service: "named", Version: "1.1", Public: true, Receiver: &named{}})
+
+	// the other version is not replaced
+	if err := sr.replace("1.0", &API{Service: "named", Version: "1.1",
+		Public: true, Receiver: &named{}}); err == nil {
+		t.Error("replace with registered version, want error")
+	}
+
+	if err := sr.replace("2.0", &API{Service: "named", Version: "2.1",
+		Public: true, Receiver: &named{}}); err != _errServiceNotFound {
+		t.Errorf("replace unknown version = %v, want service not found", err)
+	}
+
+	// the same version is replaced
+	if err := sr.replace("1.1", &API{Service: "named", Version: "1.1",
+		Public: true, Receiver: &named{name: "1.1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"service":"named","method":"name"}`)
+	if string(resp.Result) != `"1.1"` {
+		t.Errorf("response = %+v, want 1.1", resp)
+	}
+}
+
+func TestRegistryConcurrentChanges(t *testing.T) {
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{Service: "named", Version: "1.0", Public: true,
+		Receiver: &named{name: "1.0"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				resp := serveAs(t, sr, nil,
+					`{"jsonrpc":"2.0","id":1,"service":"named","method":"name"}`)
+
+				// one of versions is always registered
+				var name string
+				if err := json.Unmarshal(resp.Result, &name); err != nil {
+					t.Errorf("response = %+v, want a version", resp)
+					return
+				}
+			}
+		}()
+	}
+
+	versions := []string{"1.0", "2.0"}
+	for i := 0; i < 50; i++ {
+		old, next := versions[i%2], versions[(i+1)%2]
+		if err := sr.replace(old, &API{Service: "named", Version: next,
+			Public: true, Receiver: &named{name: next}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wg.Wait()
+}
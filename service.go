@@ -3,10 +3,12 @@ package anserpc
 import (
 	"bytes"
 	"context"
+	"errors"
 	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/chao77977/anserpc/util"
 )
@@ -14,25 +16,36 @@ import (
 var (
 	_contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 	_errorType   = reflect.TypeOf((*error)(nil)).Elem()
+
+	_errParamNamesMismatch  = errors.New("param names mismatch args of method")
+	_errDuplicateParamNames = errors.New("duplicate param names of method")
 )
 
 type groupRegister struct {
-	grp *group
-	sr  *serviceRegistry
+	name string
+	grp  *group
+	sr   *serviceRegistry
 }
 
 func newGroupRegister(name string, sr *serviceRegistry) *groupRegister {
 	return &groupRegister{
-		grp: sr.registerWithGroup(name),
-		sr:  sr,
+		name: name,
+		grp:  sr.registerWithGroup(name),
+		sr:   sr,
 	}
 }
 
-func (g *groupRegister) Register(service, version string, public bool, receiver interface{}) {
+// Use appends interceptors of group, they are run after global ones.
+func (g *groupRegister) Use(interceptors ...Interceptor) {
 	g.sr.mu.Lock()
 	defer g.sr.mu.Unlock()
 
-	g.grp.registerWithAPI(&API{
+	g.grp.ics = append(g.grp.ics, interceptors...)
+}
+
+func (g *groupRegister) Register(service, version string, public bool, receiver interface{}) {
+	g.sr.registerWithAPI(&API{
+		Group:    g.name,
 		Service:  service,
 		Version:  version,
 		Public:   public,
@@ -40,9 +53,27 @@ func (g *groupRegister) Register(service, version string, public bool, receiver
 	})
 }
 
+// Unregister removes service of version from group
+func (g *groupRegister) Unregister(service, version string) error {
+	return g.sr.unregister(g.name, service, version)
+}
+
 type serviceRegistry struct {
-	mu     sync.Mutex
-	groups map[string]*group
+	mu sync.Mutex
+	// changes of services are serialized, and observed in order
+	changeMu  sync.Mutex
+	observers []func(RegistryEvent)
+	groups    map[string]*group
+	// global interceptors
+	ics      []Interceptor
+	policy   *Policy
+	timeout  time.Duration
+	limiters []*rateLimiter
+	tracer   *tracer
+	access   *accessLogger
+	calls    *callTracker
+	// health checkers of the application
+	checkers []*healthChecker
 }
 
 func (s *serviceRegistry) modules() []string {
@@ -92,13 +123,16 @@ func (s *serviceRegistry) modules() []string {
 
 func newServiceRegistry() *serviceRegistry {
 	sr := &serviceRegistry{
-		groups: make(map[string]*group),
+		groups:  make(map[string]*group),
+		timeout: _defTimeout,
+		calls:   newCallTracker(),
 	}
 
-	for _, api := range _builtInAPIs {
+	for _, api := range builtInAPIs(sr) {
 		sr.registerWithAPI(api)
 	}
 
+	sr.observe(unregisterMethodMetrics)
 	return sr
 }
 
@@ -115,89 +149,290 @@ func (s *serviceRegistry) registerWithGroup(name string) *group {
 }
 
 func (s *serviceRegistry) registerWithAPI(api *API) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if api == nil {
 		return
 	}
 
+	srv, err := makeService(api)
+	if err != nil {
+		_xlog.Warn("Failed to register service", "group", api.Group,
+			"service", api.Service, "service version", api.Version,
+			"err", err)
+		return
+	}
+
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
 	grp := util.FormatName(api.Group)
+	s.mu.Lock()
 	if _, ok := s.groups[grp]; !ok {
 		s.groups[grp] = newGroup()
 	}
 
-	s.groups[grp].registerWithAPI(api)
+	replaced := s.groups[grp].add(srv)
+	s.mu.Unlock()
+
+	if replaced != nil {
+		s.notify(RegistryEvent{Type: ServiceReplaced, Group: grp,
+			Service: srv.name, Version: srv.version, OldVersion: replaced.version})
+	} else {
+		s.notify(RegistryEvent{Type: ServiceRegistered, Group: grp,
+			Service: srv.name, Version: srv.version})
+	}
+}
+
+func (s *serviceRegistry) use(interceptors ...Interceptor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ics = append(s.ics, interceptors...)
+}
+
+// interceptors returns interceptors of callback in order: global, group
+// and service.
+func (s *serviceRegistry) interceptors(grpName string, cb *callback) []Interceptor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ics []Interceptor
+	ics = append(ics, s.ics...)
+	if grp, ok := s.groups[util.FormatName(grpName)]; ok {
+		ics = append(ics, grp.ics...)
+	}
+
+	return append(ics, cb.ics...)
 }
 
-func (s *serviceRegistry) callback(grpName, srvName, version, method string) *callback {
+// callback returns service and callback of method, service may be not
+// public, see authorize. The version is resolved by versionRange.
+func (s *serviceRegistry) callback(grpName, srvName, version, method string) (*service, *callback, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	grp, ok := s.groups[util.FormatName(grpName)]
 	if !ok {
-		return nil
+		return nil, nil, _errMethodNotFound
 	}
 
 	srvName = util.FormatName(srvName)
-	srv := grp.load(&service{
-		name:    srvName,
-		version: version,
-	})
+	srv, candidates := grp.resolve(srvName, version)
+	if srv == nil {
+		// versions of services which are not public are not listed
+		var versions []string
+		for _, c := range candidates {
+			if c.public {
+				versions = append(versions, c.version)
+			}
+		}
 
-	if srv == nil || srv.name != srvName || !srv.public {
-		return nil
+		if len(versions) == 0 {
+			return nil, nil, _errMethodNotFound
+		}
+
+		sortVersions(versions)
+		return nil, nil, _errVersionNotFound.withData(map[string]interface{}{
+			"service":   srvName,
+			"requested": version,
+			"available": versions,
+		})
 	}
 
-	cb, _ := srv.callbacks[util.FormatName(method)]
-	return cb
+	cb, ok := srv.callbacks[util.FormatName(method)]
+	if !ok {
+		return nil, nil, _errMethodNotFound
+	}
+
+	return srv, cb, nil
 }
 
-type group struct {
-	services []*service
+func (s *serviceRegistry) setTimeout(timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if timeout > 0 {
+		s.timeout = timeout
+	}
 }
 
-func newGroup() *group {
-	return &group{
-		services: make([]*service, 0),
+// timeoutOf returns timeout of method, service or the global one
+func (s *serviceRegistry) timeoutOf(cb *callback) time.Duration {
+	if cb.timeout > 0 {
+		return cb.timeout
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.timeout
 }
 
-func (g *group) registerWithAPI(api *API) {
-	if api == nil {
-		return
+func (s *serviceRegistry) setRateLimits(opts ...*rateLimitOpt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limiters = nil
+	for _, opt := range opts {
+		s.limiters = append(s.limiters, newRateLimiter(opt))
 	}
+}
 
-	srv, err := makeService(api.Service, api.Version,
-		api.Public, reflect.ValueOf(api.Receiver))
-	if err != nil {
-		_xlog.Warn("Failed to register service", "group", api.Group,
-			"service", api.Service, "service version", api.Version,
-			"err", err)
+// allow returns false if the request of srv is over any rate limit,
+// tokens are only taken if it is allowed by all of them.
+func (s *serviceRegistry) allow(ctx context.Context, req *Request, srv *service) bool {
+	s.mu.Lock()
+	limiters := s.limiters
+	s.mu.Unlock()
+
+	keys := make([]string, len(limiters))
+	for i, l := range limiters {
+		keys[i] = l.keyOf(ctx, req, srv)
+		if l.take(keys[i]) {
+			continue
+		}
+
+		for j := 0; j < i; j++ {
+			limiters[j].giveBack(keys[j])
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func (s *serviceRegistry) setTracer(t *tracer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tracer = t
+}
+
+// tracing returns nil if tracing is disabled
+func (s *serviceRegistry) tracing() *tracer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tracer
+}
+
+func (s *serviceRegistry) setAccessLog(a *accessLogger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.access = a
+}
+
+// accessLogging returns nil if access log is disabled
+func (s *serviceRegistry) accessLogging() *accessLogger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.access
+}
+
+func (s *serviceRegistry) setPolicy(policy *Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if policy == nil {
+		s.policy = nil
 		return
 	}
 
-	g.add(srv)
+	s.policy = policy.rules()
 }
 
-func (g *group) load(s *service) *service {
-	l := len(g.services)
-	if l == 0 {
+// authorize checks the principal of ctx against policy. Methods of
+// service, which is not public and not matched by policy, are denied to
+// authenticated callers, and not found by the others.
+func (s *serviceRegistry) authorize(ctx context.Context, grpName string, srv *service, method string) error {
+	s.mu.Lock()
+	enforced := s.policy != nil
+	roles, ok := s.policy.roles(util.FormatName(grpName), srv.fingerprint(),
+		util.FormatName(method))
+	s.mu.Unlock()
+
+	if !ok {
+		if srv.public {
+			return nil
+		}
+
+		if _, ok := PrincipalFromContext(ctx); ok && enforced {
+			return _errPermissionDenied
+		}
+
+		return _errMethodNotFound
+	}
+
+	if len(roles) == 0 {
 		return nil
 	}
 
-	i := sort.Search(l, func(i int) bool {
-		return bytes.Compare(g.services[i].fingerprint(), s.fingerprint()) >= 0
-	})
+	if p, ok := PrincipalFromContext(ctx); ok && p.hasAnyRole(roles) {
+		return nil
+	}
+
+	return _errPermissionDenied
+}
+
+type group struct {
+	services []*service
+	ics      []Interceptor
+}
+
+func newGroup() *group {
+	return &group{
+		services: make([]*service, 0),
+	}
+}
+
+// resolve returns the newest service of name matched by version, and all
+// services of name.
+func (g *group) resolve(name, version string) (*service, []*service) {
+	r := parseVersionRange(version)
+	var matched *service
+	var candidates []*service
+
+	// services are sorted by fingerprint, but names of services are not
+	// in order, e.g. net, net2_1.0 and net_1.0
+	for _, srv := range g.services {
+		if srv.name != name {
+			continue
+		}
+
+		candidates = append(candidates, srv)
+		if !r.match(srv.version) {
+			continue
+		}
+
+		// the exact version is preferred
+		if srv.version == version {
+			return srv, candidates
+		}
+
+		if matched == nil || newer(srv.version, matched.version) {
+			matched = srv
+		}
+	}
 
-	if i >= l {
-		i = l - 1
+	// only pre-releases are there
+	if matched == nil && r.newest {
+		for _, srv := range candidates {
+			if matched == nil || newer(srv.version, matched.version) {
+				matched = srv
+			}
+		}
 	}
 
-	return g.services[i]
+	return matched, candidates
 }
 
-func (g *group) add(s *service) {
+// add adds service, and returns the service of the same fingerprint which
+// is replaced by it. Services are copied on write, the slice read by
+// others is never changed.
+func (g *group) add(s *service) *service {
+	var replaced *service
 	srvs := make([]*service, len(g.services))
 	copy(srvs, g.services)
 	i := sort.Search(len(srvs), func(i int) bool {
@@ -205,6 +440,7 @@ func (g *group) add(s *service) {
 	})
 
 	if i < len(srvs) && bytes.Compare(srvs[i].fingerprint(), s.fingerprint()) == 0 {
+		replaced = srvs[i]
 		srvs[i] = s
 	} else if i < len(g.services) {
 		srvs = append(srvs, &service{})
@@ -215,6 +451,33 @@ func (g *group) add(s *service) {
 	}
 
 	g.services = srvs
+	return replaced
+}
+
+func (g *group) contains(fingerprint []byte) bool {
+	for _, srv := range g.services {
+		if bytes.Equal(srv.fingerprint(), fingerprint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remove removes service of fingerprint, and returns it
+func (g *group) remove(fingerprint []byte) *service {
+	for i, srv := range g.services {
+		if !bytes.Equal(srv.fingerprint(), fingerprint) {
+			continue
+		}
+
+		srvs := make([]*service, 0, len(g.services)-1)
+		srvs = append(srvs, g.services[:i]...)
+		g.services = append(srvs, g.services[i+1:]...)
+		return srv
+	}
+
+	return nil
 }
 
 type service struct {
@@ -222,6 +485,7 @@ type service struct {
 	version   string
 	callbacks map[string]*callback
 	public    bool
+	checkers  []*healthChecker
 }
 
 func (s service) fingerprint() []byte {
@@ -243,24 +507,89 @@ func (s *service) methods() []string {
 	return names
 }
 
-func makeService(name, version string, public bool, rcvr reflect.Value) (*service, error) {
-	if name == "" {
+func makeService(api *API) (*service, error) {
+	if api.Service == "" {
 		return nil, _errServiceNotFound
 	}
 
-	cbs, err := makeCallbacks(rcvr)
+	cbs, err := makeCallbacks(reflect.ValueOf(api.Receiver))
 	if err != nil {
 		return nil, err
 	}
 
+	// checkers are not methods of service
+	checkers := checkersOf(apiName(api), api.Receiver)
+	if len(checkers) != 0 {
+		delete(cbs, "checkhealth")
+		delete(cbs, "checkready")
+	}
+
+	for method, name := range api.renames {
+		cb, ok := cbs[util.FormatName(method)]
+		if !ok {
+			return nil, _errMethodNotFound
+		}
+
+		delete(cbs, util.FormatName(method))
+		cbs[name] = cb
+	}
+
+	for method, names := range api.ParamNames {
+		cb, ok := cbs[util.FormatName(method)]
+		if !ok {
+			return nil, _errMethodNotFound
+		}
+
+		if len(names) != len(cb.argTypes) {
+			return nil, _errParamNamesMismatch
+		}
+
+		if util.WithStringSet(names).Len() != len(names) {
+			return nil, _errDuplicateParamNames
+		}
+
+		cb.paramNames = names
+	}
+
+	sem := newSemaphore(api.MaxConcurrency)
+	for _, cb := range cbs {
+		cb.ics = api.Interceptors
+		cb.timeout = api.Timeout
+		cb.sem = sem
+	}
+
+	for method, timeout := range api.MethodTimeouts {
+		cb, ok := cbs[util.FormatName(method)]
+		if !ok {
+			return nil, _errMethodNotFound
+		}
+
+		cb.timeout = timeout
+	}
+
 	return &service{
-		name:      util.FormatName(name),
-		version:   version,
+		name:      util.FormatName(api.Service),
+		version:   api.Version,
 		callbacks: cbs,
-		public:    public,
+		public:    api.Public,
+		checkers:  checkers,
 	}, nil
 }
 
+// apiName returns name of api, e.g. "group/service_version"
+func apiName(api *API) string {
+	name := util.FormatName(api.Service)
+	if api.Version != "" {
+		name += "_" + api.Version
+	}
+
+	if api.Group != "" {
+		name = util.FormatName(api.Group) + "/" + name
+	}
+
+	return name
+}
+
 type callback struct {
 	// function of method and receiver
 	fn   reflect.Value
@@ -269,11 +598,26 @@ type callback struct {
 	//  args-in of method
 	argTypes []reflect.Type
 
+	// names of args, object params are mapped onto args by them
+	paramNames []string
+
 	// the first arg of method is ctx or not
 	hasCtx bool
 
 	// -1: no return value, 0: only error return, 1: result and error return
 	returnType int
+
+	// the method takes ctx and returns subscription
+	isSubscribe bool
+
+	// interceptors of service
+	ics []Interceptor
+
+	// timeout of method, the global one is used if it is 0
+	timeout time.Duration
+
+	// in-flight limit of service, shared by callbacks of service
+	sem semaphore
 }
 
 func makeCallbacks(rcvr reflect.Value) (map[string]*callback, error) {
@@ -342,6 +686,7 @@ func makeCallback(rcvr, fn reflect.Value) (*callback, error) {
 		}
 
 		cb.returnType = 1
+		cb.isSubscribe = hasCtx && fnType.Out(0) == _subscriptionType
 	} else if numOfOut > 2 {
 		return nil, _errNumOfResult
 	}
@@ -0,0 +1,124 @@
+package anserpc
+
+import (
+	"sync"
+)
+
+const (
+	_goingAwayReason = "server is shutting down"
+)
+
+// callTracker counts calls in handling. New calls are rejected once it
+// is draining, and calls in running are aborted once draining is timeout.
+// It is reset once the application runs again.
+type callTracker struct {
+	mu       sync.Mutex
+	n        int
+	draining bool
+	idle     chan struct{}
+	abortC   chan struct{}
+	isAbort  bool
+}
+
+func newCallTracker() *callTracker {
+	return &callTracker{
+		abortC: make(chan struct{}),
+	}
+}
+
+// begin returns false if it is draining
+func (c *callTracker) begin() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.draining {
+		return false
+	}
+
+	c.n++
+	return true
+}
+
+// done ends n calls once their responses are written
+func (c *callTracker) done(n int) {
+	if n == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.n -= n
+	if c.n == 0 && c.idle != nil {
+		close(c.idle)
+		c.idle = nil
+	}
+}
+
+func (c *callTracker) isDraining() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.draining
+}
+
+// drain rejects new calls, the returned channel is closed once no call
+// is in handling.
+func (c *callTracker) drain() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.draining = true
+	if c.idle != nil {
+		return c.idle
+	}
+
+	idle := make(chan struct{})
+	if c.n == 0 {
+		close(idle)
+	} else {
+		c.idle = idle
+	}
+
+	return idle
+}
+
+// abort cancels calls in running, and returns how many of them are
+// abandoned.
+func (c *callTracker) abort() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isAbort {
+		close(c.abortC)
+		c.isAbort = true
+	}
+
+	return c.n
+}
+
+func (c *callTracker) aborted() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.abortC
+}
+
+// reset accepts new calls again, calls abandoned by the last shutdown
+// are still counted until they are done.
+func (c *callTracker) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.draining = false
+	if c.isAbort {
+		c.abortC = make(chan struct{})
+		c.isAbort = false
+	}
+}
+
+// goingAwayCodec is the codec that tells client the server is going
+// away, e.g. close frame of Websocket.
+type goingAwayCodec interface {
+	goingAway(reason string)
+}
@@ -0,0 +1,223 @@
+package anserpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// runApp runs app with HTTP and IPC servers on random port and temp path
+func runApp(t *testing.T, rcvr interface{}) (*Anser, string, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "anserpc-shutdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "anser.rpc")
+	app := New(
+		WithRPCEndpoint("127.0.0.1", 0),
+		WithIPCEndpoint(path),
+		WithDisableInterruptHandler(),
+	)
+
+	app.RegisterService("blocker", "1.0", true, rcvr)
+	go app.Run()
+
+	for i := 0; i < 100; i++ {
+		if app.statusRPCServer() == _statRunning && app.statusIPCServer() == _statRunning {
+			return app, app.rs.listenAddr(), path
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("app is not running")
+	return nil, "", ""
+}
+
+func TestShutdownDrain(t *testing.T) {
+	b := &blocker{started: make(chan struct{}, 1), release: make(chan struct{})}
+	app, addr, _ := runApp(t, b)
+
+	respC := make(chan string, 1)
+	go func() {
+		resp, err := http.Post("http://"+addr, _defAppJson, strings.NewReader(
+			`{"jsonrpc":"2.0","id":1,"service":"blocker","method":"block"}`))
+		if err != nil {
+			respC <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		respC <- string(body)
+	}()
+	<-b.started
+
+	type shutdownResult struct {
+		abandoned int
+		err       error
+	}
+
+	done := make(chan shutdownResult, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		n, err := app.Shutdown(ctx)
+		done <- shutdownResult{n, err}
+	}()
+
+	// new connections are refused, but the call in handling is completed
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+
+		conn.Close()
+		if i == 100 {
+			t.Fatal("connections are still accepted")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(b.release)
+	if resp := <-respC; !strings.Contains(resp, `"result":"released"`) {
+		t.Errorf("response = %s, want released", resp)
+	}
+
+	if r := <-done; r.abandoned != 0 || r.err != nil {
+		t.Errorf("shutdown = (%d, %v), want nothing abandoned", r.abandoned, r.err)
+	}
+}
+
+func TestShutdownAbandon(t *testing.T) {
+	b := &blocker{started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(b.release)
+	app, addr, path := runApp(t, b)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	ipc, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ipc.Close()
+
+	ws.WriteJSON(json.RawMessage(`{"jsonrpc":"2.0","id":1,"service":"blocker","method":"block"}`))
+	<-b.started
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		n, err := app.Shutdown(ctx)
+		if n != 1 {
+			t.Errorf("abandoned %d calls, want 1", n)
+		}
+
+		done <- err
+	}()
+
+	for !app.sr.calls.isDraining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// new calls on open connections are rejected
+	ipc.Write([]byte(`{"jsonrpc":"2.0","id":2,"service":"blocker","method":"block"}`))
+	var resp jsonMessage
+	if err := json.NewDecoder(bufio.NewReader(ipc)).Decode(&resp); err != nil ||
+		!resp.hasErr() || resp.Error.Code != _errShuttingDown.ErrorCode() {
+		t.Errorf("IPC response = %+v (%v), want shutting down", resp.Error, err)
+	}
+
+	// Websocket client is told why the connection is closed
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) ||
+			!strings.Contains(err.Error(), _goingAwayReason) {
+			t.Errorf("Websocket is closed by %v, want going away", err)
+		}
+
+		break
+	}
+
+	if err := <-done; err != context.DeadlineExceeded {
+		t.Errorf("shutdown error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestRunAfterClose(t *testing.T) {
+	b := &blocker{started: make(chan struct{}, 1), release: make(chan struct{})}
+	close(b.release)
+
+	app := New(WithRPCEndpoint("127.0.0.1", 0), WithDisableInterruptHandler())
+	app.RegisterService("blocker", "1.0", true, b)
+
+	run := func() (string, <-chan struct{}) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			app.Run()
+		}()
+
+		for i := 0; i < 100; i++ {
+			if app.statusRPCServer() == _statRunning {
+				return app.rs.listenAddr(), done
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatal("app is not running")
+		return "", nil
+	}
+
+	_, done := run()
+	app.Close()
+	<-done
+
+	addr, done := run()
+	defer func() {
+		app.Close()
+		<-done
+	}()
+
+	// calls are not rejected as shutting down
+	resp, err := http.Post("http://"+addr, _defAppJson, strings.NewReader(
+		`{"jsonrpc":"2.0","id":1,"service":"blocker","method":"block"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"result":"released"`) {
+		t.Errorf("response = %s, want released", body)
+	}
+}
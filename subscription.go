@@ -0,0 +1,204 @@
+package anserpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+const (
+	_subscribeMethod    = "subscribe"
+	_unsubscribeMethod  = "unsubscribe"
+	_notificationMethod = "subscription"
+)
+
+var (
+	_subscriptionType = reflect.TypeOf((*Subscription)(nil))
+)
+
+// NotifierFromContext returns the notifier of connection, it is only
+// available on the connections which support pushing, e.g. Websocket
+// and IPC.
+func NotifierFromContext(ctx context.Context) (*Notifier, bool) {
+	n, ok := ctx.Value("anser-notifier").(*Notifier)
+	return n, ok
+}
+
+type ID string
+
+func newID() ID {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return ID("0x" + hex.EncodeToString(b))
+}
+
+// Subscription is created by Notifier, the method which returns
+// *Subscription can only be called by built-in method "subscribe".
+type Subscription struct {
+	ID ID
+
+	n         *Notifier
+	activated bool
+	buffer    []interface{}
+	err       chan error
+}
+
+// Err returns a channel which is closed once client unsubscribes or
+// the connection is closed.
+func (s *Subscription) Err() <-chan error {
+	return s.err
+}
+
+type subscriptionResult struct {
+	ID     ID          `json:"subscription"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+type Notifier struct {
+	codec  serviceCodec
+	mu     sync.Mutex
+	subs   map[ID]*Subscription
+	closed bool
+}
+
+func newNotifier(codec serviceCodec) *Notifier {
+	return &Notifier{
+		codec: codec,
+		subs:  make(map[ID]*Subscription),
+	}
+}
+
+// CreateSubscription returns a new subscription, notifications are
+// buffered until the subscription id is sent to client.
+func (n *Notifier) CreateSubscription() *Subscription {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	sub := &Subscription{
+		ID:  newID(),
+		n:   n,
+		err: make(chan error),
+	}
+
+	if n.closed {
+		close(sub.err)
+		return sub
+	}
+
+	n.subs[sub.ID] = sub
+	return sub
+}
+
+// Notify sends data to client as a notification of subscription.
+func (n *Notifier) Notify(id ID, data interface{}) error {
+	n.mu.Lock()
+	sub, ok := n.subs[id]
+	if !ok {
+		n.mu.Unlock()
+		return _errSubscriptionNotFound
+	}
+
+	if !sub.activated {
+		sub.buffer = append(sub.buffer, data)
+		n.mu.Unlock()
+		return nil
+	}
+	n.mu.Unlock()
+
+	// writing to a slow client must not block other subscriptions
+	return n.send(id, data)
+}
+
+func (n *Notifier) send(id ID, data interface{}) error {
+	params, err := json.Marshal(&subscriptionResult{
+		ID:     id,
+		Result: data,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = n.codec.writeTo(context.Background(), &jsonMessage{
+		Version: _defJsonRpcVersion,
+		Method:  _notificationMethod,
+		Params:  params,
+	})
+	return err
+}
+
+func (n *Notifier) activate(subs []*Subscription) {
+	for _, sub := range subs {
+		n.flush(sub)
+	}
+}
+
+// flush sends buffered notifications of sub without holding the lock,
+// sub is activated once its buffer is empty, so notifications are sent
+// in order.
+func (n *Notifier) flush(sub *Subscription) {
+	for {
+		n.mu.Lock()
+		if _, ok := n.subs[sub.ID]; !ok || sub.activated {
+			n.mu.Unlock()
+			return
+		}
+
+		buffer := sub.buffer
+		sub.buffer = nil
+		if len(buffer) == 0 {
+			sub.activated = true
+		}
+		n.mu.Unlock()
+
+		if len(buffer) == 0 {
+			return
+		}
+
+		for _, data := range buffer {
+			if err := n.send(sub.ID, data); err != nil {
+				_xlog.Debug("Failed to notify", "subscription", sub.ID,
+					"err", err)
+			}
+		}
+	}
+}
+
+func (n *Notifier) unsubscribe(id ID) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	sub, ok := n.subs[id]
+	if !ok {
+		return false
+	}
+
+	delete(n.subs, id)
+	close(sub.err)
+	return true
+}
+
+// subscribed reports whether any subscription is alive
+func (n *Notifier) subscribed() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return len(n.subs) != 0
+}
+
+func (n *Notifier) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return
+	}
+
+	n.closed = true
+	for id, sub := range n.subs {
+		delete(n.subs, id)
+		close(sub.err)
+	}
+}
@@ -0,0 +1,224 @@
+package anserpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ticker struct {
+	subs chan *Subscription
+}
+
+func (t *ticker) Count(ctx context.Context, n int) (*Subscription, error) {
+	ntf, ok := NotifierFromContext(ctx)
+	if !ok {
+		return nil, errors.New("notifier not found")
+	}
+
+	sub := ntf.CreateSubscription()
+	// notified before the subscription id is responded
+	for i := 0; i < n; i++ {
+		ntf.Notify(sub.ID, i)
+	}
+
+	t.subs <- sub
+	return sub, nil
+}
+
+func (t *ticker) Hello() (string, error) { return "hello", nil }
+
+// servePush is like serve, but the codec supports pushing
+func servePush(t *testing.T, sr *serviceRegistry, req string) ([]*jsonMessage, *jsonCodec) {
+	t.Helper()
+
+	conn := &testConn{Reader: strings.NewReader(req)}
+	jcodec := newCodec(conn)
+	jcodec.enableNotifier()
+
+	doHandle(context.Background(), jcodec, sr)
+
+	var msgs []*jsonMessage
+	dec := json.NewDecoder(strings.NewReader(conn.out.String()))
+	for dec.More() {
+		var msg jsonMessage
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatalf("invalid output %q: %v", conn.out.String(), err)
+		}
+
+		msgs = append(msgs, &msg)
+	}
+
+	return msgs, jcodec
+}
+
+func TestSubscribe(t *testing.T) {
+	tk := &ticker{subs: make(chan *Subscription, 1)}
+	sr := newTestRegistry(tk)
+
+	msgs, jcodec := servePush(t, sr,
+		`{"jsonrpc":"2.0","id":1,"service":"test","method":"subscribe","params":["count",2]}`)
+	defer jcodec.close()
+
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want 3", len(msgs))
+	}
+
+	var id ID
+	if err := json.Unmarshal(msgs[0].Result, &id); err != nil || id == "" {
+		t.Fatalf("first message %+v is not subscription id", msgs[0])
+	}
+
+	for i, msg := range msgs[1:] {
+		if msg.Method != _notificationMethod || len(msg.ID) != 0 {
+			t.Fatalf("message %d is not notification: %+v", i+1, msg)
+		}
+
+		var result struct {
+			ID     ID  `json:"subscription"`
+			Result int `json:"result"`
+		}
+
+		if err := json.Unmarshal(msg.Params, &result); err != nil {
+			t.Fatalf("invalid notification params: %v", err)
+		}
+
+		if result.ID != id || result.Result != i {
+			t.Errorf("notification %d = %+v, want (%s, %d)", i, result, id, i)
+		}
+	}
+
+	// subscription is ended once the connection is gone
+	sub := <-tk.subs
+	codecs := newCodecSet()
+	codecs.add(jcodec)
+	codecs.remove(jcodec)
+
+	select {
+	case <-sub.Err():
+	case <-time.After(time.Second):
+		t.Error("subscription is not closed with connection")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	tk := &ticker{subs: make(chan *Subscription, 1)}
+	sr := newTestRegistry(tk)
+
+	conn := &testConn{Reader: strings.NewReader(`{"jsonrpc":"2.0","id":1,` +
+		`"service":"test","method":"subscribe","params":["count",0]}`)}
+	jcodec := newCodec(conn)
+	jcodec.enableNotifier()
+	defer jcodec.close()
+
+	doHandle(context.Background(), jcodec, sr)
+	sub := <-tk.subs
+
+	req := `{"jsonrpc":"2.0","id":2,"service":"test","method":"unsubscribe","params":["` +
+		string(sub.ID) + `"]}`
+	conn.Reader = strings.NewReader(req + req)
+	conn.out.Reset()
+	jcodec = newCodec(conn)
+	jcodec.ntf = sub.n
+
+	doHandle(context.Background(), jcodec, sr)
+	doHandle(context.Background(), jcodec, sr)
+
+	var first, second jsonMessage
+	dec := json.NewDecoder(strings.NewReader(conn.out.String()))
+	if err := dec.Decode(&first); err != nil || string(first.Result) != "true" {
+		t.Errorf("unsubscribe = %s, want true", conn.out.String())
+	}
+
+	if err := dec.Decode(&second); err != nil || !second.hasErr() ||
+		second.Error.Code != _errSubscriptionNotFound.ErrorCode() {
+		t.Errorf("second unsubscribe = %s, want subscription not found",
+			conn.out.String())
+	}
+
+	select {
+	case <-sub.Err():
+	default:
+		t.Error("subscription is not closed on unsubscribe")
+	}
+}
+
+func TestSubscribeUnsupported(t *testing.T) {
+	sr := newTestRegistry(&ticker{subs: make(chan *Subscription, 1)})
+
+	// connection without notifier, e.g. HTTP
+	out, _ := serve(t, sr,
+		`{"jsonrpc":"2.0","id":1,"service":"test","method":"subscribe","params":["count",1]}`)
+
+	var resp jsonMessage
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", out, err)
+	}
+
+	if !resp.hasErr() ||
+		resp.Error.Code != _errNotificationsUnsupported.ErrorCode() {
+		t.Errorf("response = %s, want notifications not supported", out)
+	}
+}
+
+func TestSubscriptionMethodNotCallable(t *testing.T) {
+	sr := newTestRegistry(&ticker{subs: make(chan *Subscription, 1)})
+
+	for _, req := range []string{
+		// subscription method is only called by subscribe
+		`{"jsonrpc":"2.0","id":1,"service":"test","method":"count","params":[1]}`,
+		// normal method can not be subscribed
+		`{"jsonrpc":"2.0","id":2,"service":"test","method":"subscribe","params":["hello"]}`,
+	} {
+		msgs, jcodec := servePush(t, sr, req)
+		jcodec.close()
+
+		if len(msgs) != 1 || !msgs[0].hasErr() ||
+			msgs[0].Error.Code != _errMethodNotFound.ErrorCode() {
+			t.Errorf("response of %s = %+v, want method not found", req, msgs)
+		}
+	}
+}
+
+func TestNotifyNotBlocked(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+
+	jcodec := newCodec(conn)
+	jcodec.enableNotifier()
+	defer jcodec.close()
+
+	ntf := jcodec.notifier()
+	sub := ntf.CreateSubscription()
+	ntf.activate([]*Subscription{sub})
+
+	// nothing is read from client, so the notification is blocked
+	done := make(chan error, 1)
+	go func() { done <- ntf.Notify(sub.ID, 1) }()
+
+	created := make(chan *Subscription, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		created <- ntf.CreateSubscription()
+	}()
+
+	select {
+	case <-created:
+	case <-time.After(time.Second):
+		t.Fatal("notifier is locked while writing")
+	}
+
+	var msg jsonMessage
+	if err := json.NewDecoder(client).Decode(&msg); err != nil ||
+		msg.Method != _notificationMethod {
+		t.Errorf("notification = %+v (%v)", msg, err)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("notify: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package anserpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sleeper struct {
+	errs chan error
+}
+
+// Wait returns once ctx is done or d milliseconds later
+func (s *sleeper) Wait(ctx context.Context, d int) (string, error) {
+	select {
+	case <-ctx.Done():
+		s.errs <- ctx.Err()
+		return "", ctx.Err()
+	case <-time.After(time.Duration(d) * time.Millisecond):
+		s.errs <- nil
+		return "done", nil
+	}
+}
+
+func (s *sleeper) Quick(ctx context.Context, d int) (string, error) {
+	return s.Wait(ctx, d)
+}
+
+func newTimeoutRegistry(s *sleeper, api *API) *serviceRegistry {
+	sr := newServiceRegistry()
+	sr.setTimeout(50 * time.Millisecond)
+
+	api.Service, api.Public, api.Receiver = "sleeper", true, s
+	sr.registerWithAPI(api)
+	return sr
+}
+
+func TestMethodTimeout(t *testing.T) {
+	s := &sleeper{errs: make(chan error, 1)}
+	sr := newTimeoutRegistry(s, &API{})
+
+	count := _timeoutRequestCounter.Count()
+	failures := _failureReqeustCounter.Count()
+	resp := serveAs(t, sr, nil,
+		`{"jsonrpc":"2.0","id":1,"service":"sleeper","method":"wait","params":[1000]}`)
+	if !resp.hasErr() || resp.Error.Code != _errHandleTimeout.ErrorCode() {
+		t.Fatalf("response = %+v, want timeout", resp)
+	}
+
+	select {
+	case err := <-s.errs:
+		if err != context.DeadlineExceeded {
+			t.Errorf("ctx error of method = %v, want deadline exceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ctx of method is not cancelled")
+	}
+
+	if n := _timeoutRequestCounter.Count() - count; n != 1 {
+		t.Errorf("timeout counter is increased by %d, want 1", n)
+	}
+
+	if n := _failureReqeustCounter.Count() - failures; n != 0 {
+		t.Errorf("failure counter is increased by %d, want 0", n)
+	}
+}
+
+func TestServiceAndMethodTimeout(t *testing.T) {
+	s := &sleeper{errs: make(chan error, 1)}
+	sr := newTimeoutRegistry(s, &API{
+		Timeout:        time.Second,
+		MethodTimeouts: map[string]time.Duration{"Quick": 20 * time.Millisecond},
+	})
+
+	// service timeout overrides the global one
+	resp := serveAs(t, sr, nil,
+		`{"jsonrpc":"2.0","id":1,"service":"sleeper","method":"wait","params":[100]}`)
+	if resp.hasErr() || string(resp.Result) != `"done"` {
+		t.Errorf("response of wait = %+v, want done", resp)
+	}
+	<-s.errs
+
+	// method timeout overrides the service one
+	resp = serveAs(t, sr, nil,
+		`{"jsonrpc":"2.0","id":1,"service":"sleeper","method":"quick","params":[100]}`)
+	if !resp.hasErr() || resp.Error.Code != _errHandleTimeout.ErrorCode() {
+		t.Errorf("response of quick = %+v, want timeout", resp)
+	}
+	<-s.errs
+}
+
+func TestMethodCanceled(t *testing.T) {
+	s := &sleeper{errs: make(chan error, 1)}
+	sr := newTimeoutRegistry(s, &API{Timeout: time.Second})
+
+	// the connection is gone
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	conn := &testConn{Reader: strings.NewReader(
+		`{"jsonrpc":"2.0","id":1,"service":"sleeper","method":"wait","params":[1000]}`)}
+	jcodec := newCodec(conn)
+	defer jcodec.close()
+
+	doHandle(ctx, jcodec, sr)
+	if !strings.Contains(conn.out.String(), `"code":-32016`) {
+		t.Errorf("response = %s, want request canceled", conn.out.String())
+	}
+
+	if err := <-s.errs; err != context.Canceled {
+		t.Errorf("ctx error of method = %v, want canceled", err)
+	}
+}
+
+func TestMethodTimeoutNotFound(t *testing.T) {
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{
+		Service:        "sleeper",
+		Public:         true,
+		Receiver:       &sleeper{},
+		MethodTimeouts: map[string]time.Duration{"Unknown": time.Second},
+	})
+
+	if _, cb, _ := sr.callback("", "sleeper", "", "wait"); cb != nil {
+		t.Error("service is registered with timeout of unknown method")
+	}
+}
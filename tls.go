@@ -0,0 +1,218 @@
+package anserpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	_certCheckInterval = 10 * time.Second
+)
+
+type tlsOpt struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	config       *tls.Config
+}
+
+func (t *tlsOpt) apply(opts *options) {
+	if opts.http.tls == nil {
+		opts.http.tls = &tlsOpt{}
+	}
+
+	if t.certFile != "" {
+		opts.http.tls.certFile = t.certFile
+		opts.http.tls.keyFile = t.keyFile
+	}
+
+	if t.clientCAFile != "" {
+		opts.http.tls.clientCAFile = t.clientCAFile
+	}
+
+	if t.config != nil {
+		opts.http.tls.config = t.config
+	}
+}
+
+// WithTLSOpt serves HTTP and Websocket over TLS. The certificate is
+// reloaded once the files are changed.
+func WithTLSOpt(certFile, keyFile string) Option {
+	return &tlsOpt{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+// WithTLSConfig serves HTTP and Websocket over TLS with config, the
+// certificate of WithTLSOpt is preferred if both are set.
+func WithTLSConfig(config *tls.Config) Option {
+	return &tlsOpt{
+		config: config,
+	}
+}
+
+// WithTLSClientCAOpt requires and verifies client certificates by CAs
+// of caFile(mTLS).
+func WithTLSClientCAOpt(caFile string) Option {
+	return &tlsOpt{
+		clientCAFile: caFile,
+	}
+}
+
+func (t *tlsOpt) serverConfig() (*tls.Config, *certReloader, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t.config != nil {
+		config = t.config.Clone()
+	}
+
+	var certs *certReloader
+	if t.certFile != "" {
+		var err error
+		if certs, err = newCertReloader(t.certFile, t.keyFile); err != nil {
+			return nil, nil, err
+		}
+
+		config.Certificates = nil
+		config.GetCertificate = certs.getCertificate
+	}
+
+	if t.clientCAFile != "" {
+		data, err := ioutil.ReadFile(t.clientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, nil, errors.New("no client CA certificate found")
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, certs, nil
+}
+
+// certReloader loads the certificate again if files are modified, it is
+// checked on handshake at most once per _certCheckInterval.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *certReloader) lastModified() time.Time {
+	var t time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(t) {
+			t = info.ModTime()
+		}
+	}
+
+	return t
+}
+
+func (c *certReloader) reload() error {
+	modTime := c.lastModified()
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cert, c.modTime, c.checked = &cert, modTime, time.Now()
+	return nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	cert, modTime := c.cert, c.modTime
+	checking := time.Since(c.checked) > _certCheckInterval
+	c.mu.RUnlock()
+
+	if !checking {
+		return cert, nil
+	}
+
+	c.mu.Lock()
+	c.checked = time.Now()
+	c.mu.Unlock()
+
+	if c.lastModified().After(modTime) {
+		if err := c.reload(); err != nil {
+			// the previous certificate is kept
+			_xlog.Warn("Failed to reload TLS certificate", "err", err)
+			return cert, nil
+		}
+
+		_xlog.Info("TLS certificate reloaded", "file", c.certFile)
+		c.mu.RLock()
+		cert = c.cert
+		c.mu.RUnlock()
+	}
+
+	return cert, nil
+}
+
+// withClientCert adds subject of the verified client certificate to ctx
+func withClientCert(ctx context.Context, state *tls.ConnectionState) context.Context {
+	if state == nil || len(state.VerifiedChains) == 0 ||
+		len(state.VerifiedChains[0]) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, "anser-tls-subject",
+		state.VerifiedChains[0][0].Subject)
+}
+
+// ClientCertSubjectFromContext returns subject of the verified client
+// certificate(mTLS).
+func ClientCertSubjectFromContext(ctx context.Context) (pkix.Name, bool) {
+	subject, ok := ctx.Value("anser-tls-subject").(pkix.Name)
+	return subject, ok
+}
+
+// NewClientCertAuthenticator authenticates the verified client
+// certificate as principal, the name is common name of subject and
+// roles are organizational units.
+func NewClientCertAuthenticator() Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, info *AuthInfo) (*Principal, error) {
+		if info.TLS == nil || len(info.TLS.VerifiedChains) == 0 ||
+			len(info.TLS.VerifiedChains[0]) == 0 {
+			return nil, ErrNoCredentials
+		}
+
+		subject := info.TLS.VerifiedChains[0][0].Subject
+		return &Principal{
+			Name:  subject.CommonName,
+			Roles: subject.OrganizationalUnit,
+		}, nil
+	})
+}
@@ -0,0 +1,222 @@
+package anserpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type certs struct {
+	dir    string
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	pool   *x509.CertPool
+}
+
+func newCerts(t *testing.T) *certs {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "anserpc-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &certs{dir: dir, pool: x509.NewCertPool()}
+	c.caCert, c.caKey = c.issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "anser CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, "ca")
+	c.pool.AddCert(c.caCert)
+	return c
+}
+
+// issue signs tmpl by CA, and writes name.crt and name.key
+func (c *certs) issue(t *testing.T, tmpl *x509.Certificate, name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	parent, signer := tmpl, key
+	if c.caCert != nil {
+		parent, signer = c.caCert, c.caKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(c.path(name+".crt"), certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(c.path(name+".key"), keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func (c *certs) path(name string) string {
+	return filepath.Join(c.dir, name)
+}
+
+func (c *certs) issueServer(t *testing.T, serial int64) {
+	c.issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "server"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, "server")
+}
+
+func (c *certs) clientCert(t *testing.T) tls.Certificate {
+	c.issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(100),
+		Subject: pkix.Name{
+			CommonName:         "alice",
+			OrganizationalUnit: []string{"admin"},
+		},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, "client")
+
+	cert, err := tls.LoadX509KeyPair(c.path("client.crt"), c.path("client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+type identity struct{}
+
+func (i *identity) Who(ctx context.Context) (string, error) {
+	subject, _ := ClientCertSubjectFromContext(ctx)
+	p, _ := PrincipalFromContext(ctx)
+	return subject.CommonName + "/" + p.Name, nil
+}
+
+func startTLSServer(t *testing.T, c *certs) *httpServer {
+	t.Helper()
+
+	opts := &options{http: withDefaultHTTPOpt()}
+	WithTLSOpt(c.path("server.crt"), c.path("server.key")).apply(opts)
+	WithTLSClientCAOpt(c.path("ca.crt")).apply(opts)
+
+	h := newHttpServer(opts.http, newTestRegistry(&identity{}),
+		authOpt{NewClientCertAuthenticator()})
+	h.setListenAddr(&rpcEndpoint{host: "127.0.0.1", port: 0})
+	if err := h.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func postTLS(h *httpServer, config *tls.Config) (*http.Response, *jsonMessage, error) {
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   config,
+		DisableKeepAlives: true,
+	}}
+
+	resp, err := client.Post("https://"+h.listenAddr(), _defAppJson, strings.NewReader(
+		`{"jsonrpc":"2.0","id":1,"service":"test","method":"who"}`))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var msg jsonMessage
+	err = json.NewDecoder(resp.Body).Decode(&msg)
+	return resp, &msg, err
+}
+
+func TestMutualTLS(t *testing.T) {
+	c := newCerts(t)
+	defer os.RemoveAll(c.dir)
+
+	c.issueServer(t, 10)
+	h := startTLSServer(t, c)
+	defer h.stop()
+
+	_, msg, err := postTLS(h, &tls.Config{
+		RootCAs:      c.pool,
+		Certificates: []tls.Certificate{c.clientCert(t)},
+	})
+	if err != nil || string(msg.Result) != `"alice/alice"` {
+		t.Fatalf("response = %+v %v, want alice/alice", msg, err)
+	}
+
+	// client certificate is required
+	if _, _, err := postTLS(h, &tls.Config{RootCAs: c.pool}); err == nil {
+		t.Error("request without client certificate is accepted")
+	}
+}
+
+func TestReloadCertificate(t *testing.T) {
+	c := newCerts(t)
+	defer os.RemoveAll(c.dir)
+
+	c.issueServer(t, 10)
+	h := startTLSServer(t, c)
+	defer h.stop()
+
+	config := &tls.Config{
+		RootCAs:      c.pool,
+		Certificates: []tls.Certificate{c.clientCert(t)},
+	}
+
+	serial := func() int64 {
+		resp, _, err := postTLS(h, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	if s := serial(); s != 10 {
+		t.Fatalf("serial = %d, want 10", s)
+	}
+
+	c.issueServer(t, 11)
+	if err := h.reloadCertificate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := serial(); s != 11 {
+		t.Errorf("serial after reload = %d, want 11", s)
+	}
+}
@@ -0,0 +1,284 @@
+package anserpc
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	_traceparentHeader = "traceparent"
+	_tracestateHeader  = "tracestate"
+	_traceVersion      = "00"
+	_traceFlagSampled  = 0x01
+)
+
+// SpanContext is the W3C trace context of a span, it is read from ctx of
+// method by SpanContextFromContext, and propagated by Traceparent and
+// TraceState to the services called by the method.
+type SpanContext struct {
+	TraceID    string
+	SpanID     string
+	Flags      byte
+	TraceState string
+}
+
+func (s SpanContext) IsSampled() bool {
+	return s.Flags&_traceFlagSampled != 0
+}
+
+// Traceparent returns value of header "traceparent"
+func (s SpanContext) Traceparent() string {
+	return _traceVersion + "-" + s.TraceID + "-" + s.SpanID + "-" +
+		hex.EncodeToString([]byte{s.Flags})
+}
+
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value("anser-span").(SpanContext)
+	return sc, ok
+}
+
+// parseTraceparent parses header "traceparent", future versions are
+// accepted by the fields of version 00.
+func parseTraceparent(s string) (SpanContext, bool) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == _traceVersion && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+
+	if !isTraceHex(parts[0]) || !isTraceID(parts[1], 32) ||
+		!isTraceID(parts[2], 16) || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !isTraceHex(parts[3]) {
+		return SpanContext{}, false
+	}
+
+	return SpanContext{
+		TraceID: parts[1],
+		SpanID:  parts[2],
+		Flags:   flags[0],
+	}, true
+}
+
+// isTraceID reports whether s is lowercase hex of n characters, and not
+// all zeros.
+func isTraceID(s string, n int) bool {
+	return len(s) == n && isTraceHex(s) && strings.Trim(s, "0") != ""
+}
+
+func isTraceHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withTraceHeader returns ctx with the remote span context of header,
+// spans of requests are its children.
+func withTraceHeader(ctx context.Context, header http.Header) context.Context {
+	sc, ok := parseTraceparent(header.Get(_traceparentHeader))
+	if !ok {
+		return ctx
+	}
+
+	sc.TraceState = strings.Join(header.Values(_tracestateHeader), ",")
+	return context.WithValue(ctx, "anser-span", sc)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Span is an ended span passed to SpanExporter
+type Span struct {
+	Name         string                 `json:"name"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	TraceState   string                 `json:"trace_state,omitempty"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	ErrorCode    int                    `json:"error_code,omitempty"`
+	ErrorMessage string                 `json:"error_message,omitempty"`
+}
+
+// SpanExporter exports spans once they are ended, it is called by the
+// goroutine of request, and should not block for long.
+type SpanExporter interface {
+	ExportSpan(span *Span) error
+}
+
+type SpanExporterFunc func(span *Span) error
+
+func (f SpanExporterFunc) ExportSpan(span *Span) error {
+	return f(span)
+}
+
+// FileSpanExporter writes spans as JSON lines to a file
+type FileSpanExporter struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+// NewFileSpanExporter appends spans to the file of path, it is created
+// if it does not exist.
+func NewFileSpanExporter(path string) (*FileSpanExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSpanExporter{
+		file: file,
+		w:    bufio.NewWriter(file),
+	}, nil
+}
+
+func (f *FileSpanExporter) ExportSpan(span *Span) error {
+	b, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.w.Write(b)
+	f.w.WriteByte('\n')
+	return f.w.Flush()
+}
+
+func (f *FileSpanExporter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.w.Flush()
+	return f.file.Close()
+}
+
+type tracingOpt struct {
+	exporter SpanExporter
+}
+
+func (t *tracingOpt) apply(opts *options) {
+	opts.tracer = &tracer{exporter: t.exporter}
+}
+
+// WithTracingOpt creates a span for each call and batch, the trace
+// context of header "traceparent" and "tracestate" of HTTP and Websocket
+// is the parent of them. Sampled spans are exported by exporter.
+func WithTracingOpt(exporter SpanExporter) Option {
+	return &tracingOpt{
+		exporter: exporter,
+	}
+}
+
+// tracer is nil if tracing is disabled
+type tracer struct {
+	exporter SpanExporter
+}
+
+type span struct {
+	t    *tracer
+	sc   SpanContext
+	data *Span
+	mu   sync.Mutex
+}
+
+// start starts a span of name, the span of ctx is the parent, and ctx of
+// the span is returned.
+func (t *tracer) start(ctx context.Context, name string) (context.Context, *span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	sc := SpanContext{
+		SpanID: randomHex(8),
+		Flags:  _traceFlagSampled,
+	}
+
+	parent, ok := SpanContextFromContext(ctx)
+	if ok {
+		sc.TraceID, sc.Flags, sc.TraceState = parent.TraceID,
+			parent.Flags, parent.TraceState
+	} else {
+		sc.TraceID = randomHex(16)
+	}
+
+	s := &span{
+		t:  t,
+		sc: sc,
+		data: &Span{
+			Name:       name,
+			TraceID:    sc.TraceID,
+			SpanID:     sc.SpanID,
+			TraceState: sc.TraceState,
+			Start:      time.Now(),
+			Attributes: make(map[string]interface{}),
+		},
+	}
+
+	if ok {
+		s.data.ParentSpanID = parent.SpanID
+	}
+
+	return context.WithValue(ctx, "anser-span", sc), s
+}
+
+func (s *span) setAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attributes[key] = value
+}
+
+// end ends the span with error of response, if any
+func (s *span) end(retMsg *jsonMessage) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.data.End.IsZero() {
+		return
+	}
+
+	s.data.End = time.Now()
+	if retMsg != nil && retMsg.hasErr() {
+		s.data.ErrorCode = retMsg.Error.Code
+		s.data.ErrorMessage = retMsg.Error.Message
+	}
+
+	if !s.sc.IsSampled() || s.t.exporter == nil {
+		return
+	}
+
+	if err := s.t.exporter.ExportSpan(s.data); err != nil {
+		_xlog.Debug("Span export failure", "span", s.data.Name, "err", err)
+	}
+}
@@ -0,0 +1,220 @@
+package anserpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (s *spanRecorder) ExportSpan(span *Span) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spans = append(s.spans, span)
+	return nil
+}
+
+func (s *spanRecorder) byName(name string) []*Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var spans []*Span
+	for _, span := range s.spans {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+
+	return spans
+}
+
+type traced struct{}
+
+func (t *traced) Parent(ctx context.Context) (string, error) {
+	sc, _ := SpanContextFromContext(ctx)
+	return sc.Traceparent(), nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for _, c := range []struct {
+		header string
+		ok     bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"", false},
+	} {
+		sc, ok := parseTraceparent(c.header)
+		if ok != c.ok {
+			t.Errorf("parse %q = %v, want %v", c.header, ok, c.ok)
+		}
+
+		if ok && sc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("trace id of %q = %s", c.header, sc.TraceID)
+		}
+	}
+}
+
+func TestTracingHTTP(t *testing.T) {
+	rec := &spanRecorder{}
+	sr := newTestRegistry(&traced{})
+	sr.setTracer(&tracer{exporter: rec})
+
+	ts := httptest.NewServer(newHttpServer(withDefaultHTTPOpt(), sr, nil).head)
+	defer ts.Close()
+
+	post := func(body string) string {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", _defAppJson)
+		req.Header.Set("traceparent",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		req.Header.Set("tracestate", "vendor=value")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var out json.RawMessage
+		json.NewDecoder(resp.Body).Decode(&out)
+		return string(out)
+	}
+
+	out := post(`{"jsonrpc":"2.0","id":1,"service":"test","method":"parent"}`)
+	calls := rec.byName("handler.call")
+	if len(calls) != 1 {
+		t.Fatalf("got %d call spans, want 1", len(calls))
+	}
+
+	call := calls[0]
+	if call.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		call.ParentSpanID != "00f067aa0ba902b7" || call.TraceState != "vendor=value" {
+		t.Errorf("call span %+v is not child of traceparent", call)
+	}
+
+	// the method reads the trace context of its span
+	want := "00-" + call.TraceID + "-" + call.SpanID + "-01"
+	if !strings.Contains(out, want) {
+		t.Errorf("response = %s, want traceparent %s", out, want)
+	}
+
+	if call.Attributes["rpc.method"] != "parent" ||
+		call.Attributes["rpc.transport"] != TransportHTTP {
+		t.Errorf("call attributes = %v", call.Attributes)
+	}
+
+	// calls of batch are children of the batch span
+	post(`[{"jsonrpc":"2.0","id":1,"service":"test","method":"parent"},
+		{"jsonrpc":"2.0","id":2,"service":"test","method":"unknown"}]`)
+	batches := rec.byName("handler.batch")
+	if len(batches) != 1 || batches[0].ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("batch spans = %+v, want 1 child of traceparent", batches)
+	}
+
+	calls = rec.byName("handler.call")[1:]
+	if len(calls) != 2 {
+		t.Fatalf("got %d call spans of batch, want 2", len(calls))
+	}
+
+	for _, call := range calls {
+		if call.ParentSpanID != batches[0].SpanID {
+			t.Errorf("call span %+v is not child of batch", call)
+		}
+
+		if call.Attributes["rpc.method"] == "unknown" &&
+			call.ErrorCode != _errMethodNotFound.ErrorCode() {
+			t.Errorf("error of call span = %d, want method not found", call.ErrorCode)
+		}
+	}
+}
+
+func TestTracingNotSampled(t *testing.T) {
+	rec := &spanRecorder{}
+	sr := newTestRegistry(&traced{})
+	sr.setTracer(&tracer{exporter: rec})
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx := withTraceHeader(context.Background(), header)
+
+	conn := &testConn{Reader: strings.NewReader(
+		`{"jsonrpc":"2.0","id":1,"service":"test","method":"parent"}`)}
+	jcodec := newCodec(conn)
+	defer jcodec.close()
+
+	doHandle(ctx, jcodec, sr)
+	if n := len(rec.byName("handler.call")); n != 0 {
+		t.Errorf("got %d spans, want none of unsampled trace", n)
+	}
+
+	// trace context is still propagated to the method
+	if !strings.Contains(conn.out.String(), "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+		t.Errorf("response = %s, want trace id propagated", conn.out.String())
+	}
+}
+
+func TestFileSpanExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anserpc-trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spans.jsonl")
+	exporter, err := NewFileSpanExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sr := newTestRegistry(&traced{})
+	sr.setTracer(&tracer{exporter: exporter})
+	serve(t, sr, `{"jsonrpc":"2.0","id":1,"service":"test","method":"parent"}`)
+	serve(t, sr, `{"jsonrpc":"2.0","id":2,"service":"test","method":"parent"}`)
+
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var spans []*Span
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var span Span
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+
+		spans = append(spans, &span)
+	}
+
+	// root spans of different traces
+	if len(spans) != 2 || spans[0].ParentSpanID != "" ||
+		spans[0].TraceID == spans[1].TraceID {
+		t.Errorf("spans = %+v, want 2 root spans", spans)
+	}
+}
@@ -12,6 +12,18 @@ var (
 	Fmt = util.Fmt
 )
 
+const (
+	TransportHTTP      = "http"
+	TransportWebsocket = "websocket"
+	TransportIPC       = "ipc"
+)
+
+// transportFromContext returns transport of the connection
+func transportFromContext(ctx context.Context) string {
+	transport, _ := ctx.Value("anser-transport").(string)
+	return transport
+}
+
 type serverStatus int
 
 type waitProc interface {
@@ -36,7 +48,9 @@ type WriteCloserAndDeadline interface {
 
 type serviceCodec interface {
 	readBatch() ([]*jsonMessage, bool, error)
-	writeTo(context.Context, interface{}) error
+	writeTo(context.Context, interface{}) (int, error)
+	// nil if the connection does not support pushing
+	notifier() *Notifier
 	close()
 }
 
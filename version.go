@@ -0,0 +1,170 @@
+package anserpc
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	_latestVersion = "latest"
+)
+
+// semver is the parsed version of service, e.g. 1.2.3, v1.2 and
+// 1.0.0-beta. Versions of service can be non-semver, they are only
+// matched exactly.
+type semver struct {
+	major, minor, patch int
+	pre                 string
+	// number of numeric parts, e.g. 2 for 1.2
+	parts int
+}
+
+func parseSemver(v string) (*semver, bool) {
+	v = strings.TrimPrefix(v, "v")
+	if v == "" {
+		return nil, false
+	}
+
+	sv := &semver{}
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		if v[i] == '-' {
+			sv.pre = strings.SplitN(v[i+1:], "+", 2)[0]
+		}
+
+		v = v[:i]
+	}
+
+	nums := strings.Split(v, ".")
+	if len(nums) > 3 {
+		return nil, false
+	}
+
+	for i, num := range nums {
+		n, err := strconv.Atoi(num)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+
+		switch i {
+		case 0:
+			sv.major = n
+		case 1:
+			sv.minor = n
+		case 2:
+			sv.patch = n
+		}
+	}
+
+	sv.parts = len(nums)
+	return sv, true
+}
+
+func (s *semver) compare(o *semver) int {
+	for _, d := range []int{s.major - o.major, s.minor - o.minor, s.patch - o.patch} {
+		if d != 0 {
+			return d
+		}
+	}
+
+	// pre-release is lower than release
+	switch {
+	case s.pre == o.pre:
+		return 0
+	case s.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+
+	return strings.Compare(s.pre, o.pre)
+}
+
+// versionRange is the version requested by client: "" or "latest" for
+// the newest release, "^1.2" for compatible versions(>=1.2.0 <2.0.0), "~1.2" for
+// patch versions(>=1.2.0 <1.3.0), or a version which is matched exactly.
+type versionRange struct {
+	raw    string
+	op     byte
+	lower  *semver
+	upper  *semver
+	newest bool
+}
+
+func parseVersionRange(v string) *versionRange {
+	r := &versionRange{raw: v}
+	if v == "" || strings.EqualFold(v, _latestVersion) {
+		r.newest = true
+		return r
+	}
+
+	if v[0] != '^' && v[0] != '~' {
+		r.lower, _ = parseSemver(v)
+		return r
+	}
+
+	lower, ok := parseSemver(v[1:])
+	if !ok {
+		return r
+	}
+
+	r.op, r.lower = v[0], lower
+	switch {
+	case r.op == '~' && lower.parts > 1:
+		r.upper = &semver{major: lower.major, minor: lower.minor + 1}
+	case r.op == '^' && lower.major == 0 && lower.parts > 1:
+		r.upper = &semver{minor: lower.minor + 1}
+	default:
+		r.upper = &semver{major: lower.major + 1}
+	}
+
+	return r
+}
+
+func (r *versionRange) match(version string) bool {
+	if version == r.raw {
+		return true
+	}
+
+	v, ok := parseSemver(version)
+	if r.newest {
+		// pre-releases are not the newest, see group.resolve
+		return !ok || v.pre == ""
+	}
+
+	if !ok || r.lower == nil {
+		return false
+	}
+
+	if r.op == 0 {
+		return v.compare(r.lower) == 0
+	}
+
+	// pre-releases are only matched exactly
+	if v.pre != "" {
+		return false
+	}
+
+	return v.compare(r.lower) >= 0 && v.compare(r.upper) < 0
+}
+
+// newer reports whether version a is newer than b, non-semver versions
+// are older than semver ones.
+func newer(a, b string) bool {
+	sa, okA := parseSemver(a)
+	sb, okB := parseSemver(b)
+	switch {
+	case okA && okB:
+		return sa.compare(sb) > 0
+	case okA != okB:
+		return okA
+	}
+
+	return a > b
+}
+
+func sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		return newer(versions[j], versions[i])
+	})
+}
@@ -0,0 +1,137 @@
+package anserpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type versioned struct {
+	v string
+}
+
+func (v *versioned) Version() (string, error) { return v.v, nil }
+
+func TestVersionRange(t *testing.T) {
+	for _, c := range []struct {
+		requested string
+		version   string
+		matched   bool
+	}{
+		{"", "1.0", true},
+		{"latest", "beta", true},
+		{"1.2", "1.2", true},
+		{"1.2", "1.2.0", true},
+		{"1.2", "1.2.1", false},
+		{"v1.2.0", "1.2", true},
+		{"beta", "beta", true},
+		{"^1.2", "1.2.0", true},
+		{"^1.2", "1.9.3", true},
+		{"^1.2", "1.1.9", false},
+		{"^1.2", "2.0.0", false},
+		{"^1.2", "1.5.0-rc1", false},
+		{"^0.2", "0.2.5", true},
+		{"^0.2", "0.3.0", false},
+		{"~1.0", "1.0.7", true},
+		{"~1.0", "1.1.0", false},
+		{"~1", "1.4.0", true},
+		{"^x", "1.0", false},
+	} {
+		if matched := parseVersionRange(c.requested).match(c.version); matched != c.matched {
+			t.Errorf("%q matches %q = %v, want %v", c.requested, c.version,
+				matched, c.matched)
+		}
+	}
+}
+
+func TestSortVersions(t *testing.T) {
+	versions := []string{"1.10.0", "beta", "1.2.0", "2.0.0-rc1", "2.0.0", "1.9"}
+	sortVersions(versions)
+
+	want := []string{"beta", "1.2.0", "1.9", "1.10.0", "2.0.0-rc1", "2.0.0"}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("sorted versions = %v, want %v", versions, want)
+	}
+}
+
+func newVersionRegistry() *serviceRegistry {
+	sr := newServiceRegistry()
+	for _, v := range []string{"1.0.0", "1.2.0", "1.10.1", "2.0.0", "2.1.0-beta"} {
+		sr.registerWithAPI(&API{
+			Service:  "net",
+			Version:  v,
+			Public:   true,
+			Receiver: &versioned{v: v},
+		})
+	}
+
+	// names of services are not in order of fingerprint
+	sr.registerWithAPI(&API{
+		Service:  "net2",
+		Version:  "9.0",
+		Public:   true,
+		Receiver: &versioned{v: "net2"},
+	})
+
+	return sr
+}
+
+func TestResolveVersion(t *testing.T) {
+	sr := newVersionRegistry()
+
+	for requested, want := range map[string]string{
+		"":           "2.0.0",
+		"latest":     "2.0.0",
+		"^1":         "1.10.1",
+		"~1.2":       "1.2.0",
+		"1.0":        "1.0.0",
+		"2.1.0-beta": "2.1.0-beta",
+	} {
+		resp := serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"service":"net",`+
+			`"service_version":"`+requested+`","method":"version"}`)
+
+		var got string
+		if resp.hasErr() || json.Unmarshal(resp.Result, &got) != nil || got != want {
+			t.Errorf("version %q resolved to %+v, want %s", requested, resp, want)
+		}
+	}
+}
+
+func TestVersionNotFound(t *testing.T) {
+	sr := newVersionRegistry()
+
+	resp := serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"service":"net",`+
+		`"service_version":"^3","method":"version"}`)
+	if !resp.hasErr() || resp.Error.Code != _errVersionNotFound.ErrorCode() {
+		t.Fatalf("response = %+v, want version not found", resp)
+	}
+
+	data, _ := json.Marshal(resp.Error.Data)
+	want := `{"available":["1.0.0","1.2.0","1.10.1","2.0.0","2.1.0-beta"],` +
+		`"requested":"^3","service":"net"}`
+	if string(data) != want {
+		t.Errorf("error data = %s, want %s", data, want)
+	}
+
+	// unknown service is still not found
+	resp = serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"service":"net3",`+
+		`"service_version":"1.0","method":"version"}`)
+	if !resp.hasErr() || resp.Error.Code != _errMethodNotFound.ErrorCode() {
+		t.Errorf("response = %+v, want method not found", resp)
+	}
+}
+
+func TestResolvePreRelease(t *testing.T) {
+	sr := newServiceRegistry()
+	sr.registerWithAPI(&API{
+		Service:  "net",
+		Version:  "1.0.0-rc1",
+		Public:   true,
+		Receiver: &versioned{v: "1.0.0-rc1"},
+	})
+
+	resp := serveAs(t, sr, nil, `{"jsonrpc":"2.0","id":1,"service":"net","method":"version"}`)
+	if resp.hasErr() || string(resp.Result) != `"1.0.0-rc1"` {
+		t.Errorf("response = %+v, want the only pre-release", resp)
+	}
+}
@@ -2,27 +2,27 @@ package anserpc
 
 import (
 	"context"
-	"encoding/json"
+	"io"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/chao77977/anserpc/util"
 	"github.com/gorilla/websocket"
 )
 
 const (
-	_pingInterval     = 60 * time.Second
-	_pingWriteTimeout = 5 * time.Second
+	_pingInterval         = 60 * time.Second
+	_pingWriteTimeout     = 5 * time.Second
+	_defWebsocketInFlight = 16
 )
 
 type websocketHandler struct {
 	allowed  bool
+	inFlight int
 	server   *httpServer
 	next     http.Handler
 	upgrader websocket.Upgrader
-	readErr  chan error
-	readMsg  chan readMessage
-	closeC   chan struct{}
 }
 
 func (ws *websocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -31,6 +31,22 @@ func (ws *websocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	start := time.Now()
+	ctx := context.WithValue(context.Background(), "anser-transport", TransportWebsocket)
+	ctx = withClientCert(ctx, r.TLS)
+	ctx = withTraceHeader(ctx, r.Header)
+	ctx, err := ws.server.auth.authenticate(ctx, &AuthInfo{
+		Transport:  TransportWebsocket,
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header,
+		TLS:        r.TLS,
+	})
+	if err != nil {
+		n := writeHTTPError(ctx, w, ws.selectFormat(r), http.StatusUnauthorized, err)
+		ws.server.sr.accessLogging().logRejected(ctx, r.RemoteAddr, start, err, n)
+		return
+	}
+
 	conn, err := ws.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		_xlog.Debug("WebSocket upgrade failure", "err", err)
@@ -39,88 +55,104 @@ func (ws *websocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.WithValue(context.Background(),
-		"anser-websocket-remote", conn.RemoteAddr())
+	ctx = context.WithValue(ctx, "anser-websocket-remote", conn.RemoteAddr())
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	jwc := newWebSocketCodec(conn)
+	f := formatOf(Format(conn.Subprotocol()))
+	if f == nil {
+		f = _jsonFormat
+	}
+
+	jwc := newWebSocketCodec(conn, f)
 	defer jwc.close()
 
 	ws.server.codecs.add(jwc)
 	defer ws.server.codecs.remove(jwc)
 
-	ws.doHandle(ctx, jwc)
+	sess := &websocketSession{
+		ctx:      ctx,
+		cancel:   cancel,
+		codec:    jwc,
+		sr:       ws.server.sr,
+		inFlight: make(chan struct{}, ws.inFlight),
+	}
+
+	sess.serve()
 }
 
-func (ws *websocketHandler) doHandle(ctx context.Context, jCodec serviceCodec) {
-	defer func() {
-		for {
-			select {
-			case <-ws.readErr:
-			case <-ws.readMsg:
-				return
-			}
-		}
-	}()
+// websocketSession is the state of a connection, requests on it are
+// handled concurrently, and responses are written once they are done.
+type websocketSession struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	codec  serviceCodec
+	sr     *serviceRegistry
+	// requests in handling, reading is blocked once it is full
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+}
 
-	go ws.read(ctx, jCodec)
+// serve reads requests until the connection is gone, then methods in
+// running are cancelled.
+func (s *websocketSession) serve() {
+	defer s.wg.Wait()
 
 	for {
-		select {
-		case <-ws.closeC:
+		msgs, isBatch, err := s.codec.readBatch()
+		if err != nil {
+			_xlog.Debug("Read message error", "err", err)
+			if isParseError(err) {
+				s.codec.writeTo(s.ctx, makeJSONErrorMessage(_errInvalidRequest))
+			}
+
+			s.cancel()
 			return
+		}
 
-		case err := <-ws.readErr:
-			_xlog.Debug("Read message error", "err", err)
+		select {
+		case s.inFlight <- struct{}{}:
+		case <-s.ctx.Done():
 			return
+		}
 
-		case r := <-ws.readMsg:
-			msgHdl := newHandler(ws.server.sr, ctx)
-			defer msgHdl.close()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { <-s.inFlight }()
 
-			if !r.isBatch {
-				jCodec.writeTo(ctx, msgHdl.handleMsg(r.msgs[0]))
-			} else {
-				jCodec.writeTo(ctx, msgHdl.handleMsgs(r.msgs))
-			}
-		}
+			handleAndWrite(s.ctx, s.codec, s.sr, msgs, isBatch)
+		}()
 	}
 }
 
-func (ws *websocketHandler) read(ctx context.Context, jCodec serviceCodec) {
-	defer func() {
-		if r := recover(); r != nil {
-			_xlog.Debug("Reading on failed websocket connection")
-			close(ws.closeC)
-		}
-	}()
-
-	for {
-		msgs, isBatch, err := jCodec.readBatch()
-		if err != nil {
-			if _, ok := err.(*json.SyntaxError); ok {
-				jCodec.writeTo(ctx, makeJSONErrorMessage(_errInvalidRequest))
-			}
-
-			ws.readErr <- err
-			return
+// selectFormat returns format of the subprotocol which is selected by
+// upgrader, before the connection is upgraded.
+func (ws *websocketHandler) selectFormat(r *http.Request) *wireFormat {
+	requested := util.WithStringSet(websocket.Subprotocols(r))
+	for _, p := range ws.upgrader.Subprotocols {
+		if requested.Contains(p) {
+			return formatOf(Format(p))
 		}
-
-		ws.readMsg <- readMessage{msgs, isBatch}
 	}
+
+	return _jsonFormat
 }
 
 func newWebsocketHandler(opt *httpOpt, server *httpServer, next http.Handler) http.Handler {
 	return &websocketHandler{
-		allowed: opt.WebsocketAllowed,
-		server:  server,
-		next:    next,
+		allowed:  opt.WebsocketAllowed,
+		inFlight: opt.websocketInFlight,
+		server:   server,
+		next:     next,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
+			// format of messages, it is JSON if none is selected
+			Subprotocols: []string{string(FormatJSON), string(FormatMsgpack),
+				string(FormatCBOR)},
+			CheckOrigin: checkOrigin(opt),
 		},
-		readErr: make(chan error),
-		readMsg: make(chan readMessage),
-		closeC:  make(chan struct{}),
 	}
 }
 
@@ -131,8 +163,8 @@ type webSocketCodec struct {
 	resetC chan struct{}
 }
 
-func (w *webSocketCodec) writeTo(ctx context.Context, x interface{}) error {
-	err := w.jsonCodec.writeTo(ctx, x)
+func (w *webSocketCodec) writeTo(ctx context.Context, x interface{}) (int, error) {
+	n, err := w.jsonCodec.writeTo(ctx, x)
 	if err == nil {
 		select {
 		case w.resetC <- struct{}{}:
@@ -140,7 +172,7 @@ func (w *webSocketCodec) writeTo(ctx context.Context, x interface{}) error {
 		}
 	}
 
-	return err
+	return n, err
 }
 
 func (w *webSocketCodec) ping() {
@@ -170,6 +202,14 @@ func (w *webSocketCodec) ping() {
 	}
 }
 
+// goingAway sends a close frame with reason, the connection is closed
+// once client responds to it.
+func (w *webSocketCodec) goingAway(reason string) {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	w.conn.WriteControl(websocket.CloseMessage, msg,
+		time.Now().Add(_pingWriteTimeout))
+}
+
 func (w *webSocketCodec) close() {
 	w.jsonCodec.close()
 	w.wg.Wait()
@@ -180,26 +220,59 @@ func (w *webSocketCodec) close() {
 	}
 }
 
-func newWebSocketCodec(conn *websocket.Conn) *webSocketCodec {
+func newWebSocketCodec(conn *websocket.Conn, f *wireFormat) *webSocketCodec {
 	conn.SetReadLimit(_maxReqContentLength)
+	msgType := websocket.TextMessage
+	if f.binary {
+		msgType = websocket.BinaryMessage
+	}
+
+	// a message is sent in a frame
+	out := &countingWriter{}
+	encode := func(x interface{}) error {
+		w, err := conn.NextWriter(msgType)
+		if err != nil {
+			return err
+		}
+
+		out.w = w
+		err = f.newEncoder(out)(x)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+
+		return err
+	}
+
+	decode := func(x interface{}) error {
+		_, r, err := conn.NextReader()
+		if err != nil {
+			return err
+		}
+
+		if err = f.newDecoder(r)(x); err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return err
+	}
+
 	wsc := &webSocketCodec{
 		jsonCodec: &jsonCodec{
 			closeC: make(chan struct{}),
-			encode: conn.WriteJSON,
-			decode: conn.ReadJSON,
+			encode: encode,
+			decode: decode,
+			out:    out,
 			conn:   conn,
 		},
 		conn:   conn,
 		resetC: make(chan struct{}, 1),
 	}
 
+	wsc.ntf = newNotifier(wsc)
+
 	go wsc.ping()
 	wsc.wg.Add(1)
 
 	return wsc
 }
-
-type readMessage struct {
-	msgs    []*jsonMessage
-	isBatch bool
-}
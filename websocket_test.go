@@ -0,0 +1,98 @@
+package anserpc
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWebsocket(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readResponse(t *testing.T, conn *websocket.Conn) *jsonMessage {
+	t.Helper()
+
+	var resp jsonMessage
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	return &resp
+}
+
+func newBlockerServer(b *blocker, inFlight int) *httptest.Server {
+	sr := newTestRegistry(b)
+	sr.registerWithAPI(&API{Service: "plane", Public: true, Receiver: &plane{}})
+
+	opt := withDefaultHTTPOpt()
+	opt.websocketInFlight = inFlight
+	return httptest.NewServer(newHttpServer(opt, sr, nil).head)
+}
+
+const (
+	_blockReq = `{"jsonrpc":"2.0","id":1,"service":"test","method":"block"}`
+	_sizeReq  = `{"jsonrpc":"2.0","id":2,"service":"plane","method":"size","params":["AQI="]}`
+)
+
+func TestWebsocketPipelining(t *testing.T) {
+	b := &blocker{started: make(chan struct{}, 1), release: make(chan struct{})}
+	ts := newBlockerServer(b, _defWebsocketInFlight)
+	defer ts.Close()
+
+	conn := dialWebsocket(t, ts)
+	defer conn.Close()
+
+	other := dialWebsocket(t, ts)
+	defer other.Close()
+
+	conn.WriteJSON(json.RawMessage(_blockReq))
+	<-b.started
+
+	// requests on the same and other connections are not blocked
+	for _, c := range []*websocket.Conn{conn, other} {
+		c.WriteJSON(json.RawMessage(_sizeReq))
+		if resp := readResponse(t, c); string(resp.ID) != "2" || string(resp.Result) != "2" {
+			t.Errorf("response = %+v, want result of 2", resp)
+		}
+	}
+
+	close(b.release)
+	if resp := readResponse(t, conn); string(resp.ID) != "1" ||
+		string(resp.Result) != `"released"` {
+		t.Errorf("response = %+v, want result of 1", resp)
+	}
+}
+
+func TestWebsocketInFlightLimit(t *testing.T) {
+	b := &blocker{started: make(chan struct{}, 1), release: make(chan struct{})}
+	ts := newBlockerServer(b, 1)
+	defer ts.Close()
+
+	conn := dialWebsocket(t, ts)
+	defer conn.Close()
+
+	conn.WriteJSON(json.RawMessage(_blockReq))
+	<-b.started
+	conn.WriteJSON(json.RawMessage(_sizeReq))
+
+	// the later request waits until the first one is done
+	close(b.release)
+	for _, id := range []string{"1", "2"} {
+		if resp := readResponse(t, conn); string(resp.ID) != id || resp.hasErr() {
+			t.Errorf("response = %+v, want result of %s", resp, id)
+		}
+	}
+}